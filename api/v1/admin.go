@@ -0,0 +1,64 @@
+package v1
+
+// CacheEntry describes a cached forecast.
+type CacheEntry struct {
+	Key       string   `json:"key"`
+	StoredAt  Time3339 `json:"storedAt"`
+	ExpiresAt Time3339 `json:"expiresAt"`
+	// Age is the number of seconds since the entry was stored.
+	Age int64 `json:"age"`
+	// TTL is the number of seconds until the entry expires, negative once expired.
+	TTL      int64     `json:"ttl"`
+	Forecast *Forecast `json:"forecast,omitempty"`
+}
+
+// ListCacheEntriesResponse represents the response listing cache entries.
+type ListCacheEntriesResponse struct {
+	Entries []*CacheEntry `json:"entries"`
+}
+
+// PurgeCacheResponse represents the response to purging cache entries.
+type PurgeCacheResponse struct {
+	Purged int `json:"purged"`
+}
+
+// CacheStats represents the counters of the forecast cache.
+type CacheStats struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+	Entries     int    `json:"entries"`
+	Bytes       int64  `json:"bytes"`
+}
+
+// UsageCounters represents the usage of a consumer.
+type UsageCounters struct {
+	Requests      int64 `json:"requests"`
+	Cities        int64 `json:"cities"`
+	CacheHits     int64 `json:"cacheHits"`
+	UpstreamCalls int64 `json:"upstreamCalls"`
+}
+
+// DailyUsage represents the usage of a consumer on a UTC day.
+type DailyUsage struct {
+	// Date is the UTC day, formatted as YYYY-MM-DD.
+	Date string `json:"date"`
+	UsageCounters
+}
+
+// ConsumerUsage represents the usage of a consumer over a period.
+type ConsumerUsage struct {
+	Consumer string        `json:"consumer"`
+	Total    UsageCounters `json:"total"`
+	Days     []*DailyUsage `json:"days"`
+}
+
+// UsageResponse represents the response to querying the usage of consumers.
+type UsageResponse struct {
+	// From and To are the first and last UTC days of the period, formatted
+	// as YYYY-MM-DD.
+	From      string           `json:"from"`
+	To        string           `json:"to"`
+	Consumers []*ConsumerUsage `json:"consumers"`
+}
@@ -0,0 +1,24 @@
+package v1
+
+// Health statuses reported by the health endpoints.
+const (
+	HealthStatusOK       = "ok"
+	HealthStatusDegraded = "degraded"
+	HealthStatusFailing  = "failing"
+	HealthStatusDraining = "draining"
+)
+
+// HealthResponse represents the response of the liveness and readiness
+// endpoints.
+type HealthResponse struct {
+	Status string                  `json:"status"`
+	Checks map[string]*HealthCheck `json:"checks,omitempty"`
+}
+
+// HealthCheck represents the result of checking a dependency.
+type HealthCheck struct {
+	Status string `json:"status"`
+	// Critical reports whether the service is not ready while the check fails.
+	Critical bool   `json:"critical"`
+	Error    string `json:"error,omitempty"`
+}
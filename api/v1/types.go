@@ -11,8 +11,26 @@ type Detail struct {
 type Forecast struct {
 	Name   string    `json:"name"`
 	Detail []*Detail `json:"detail"`
+	// Stale reports whether the forecast is served from an expired cache entry.
+	Stale bool `json:"stale,omitempty"`
+	// Age is the number of seconds since a stale forecast was retrieved.
+	Age int64 `json:"age,omitempty"`
+	// Status is set when the forecast is missing, e.g. to ForecastStatusTimeout
+	// when it was not retrieved within the time budget of the city, or to
+	// ForecastStatusOverloaded when it was shed.
+	Status string `json:"status,omitempty"`
 }
 
+// Statuses of the forecasts which are missing.
+const (
+	// ForecastStatusTimeout is the status of the forecasts which were not
+	// retrieved in time.
+	ForecastStatusTimeout = "timeout"
+	// ForecastStatusOverloaded is the status of the forecasts which were not
+	// cached, and not retrieved as the service is overloaded.
+	ForecastStatusOverloaded = "overloaded"
+)
+
 // ListWeatherResponse represents the response for the v1 API.
 type ListWeatherResponse struct {
 	Forecast []*Forecast `json:"forecast"`
@@ -2,69 +2,546 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
+	v1 "github.com/cityhunteur/weather-service/api/v1"
+	"github.com/cityhunteur/weather-service/internal/admission"
+	"github.com/cityhunteur/weather-service/internal/auth"
 	"github.com/cityhunteur/weather-service/internal/cache"
+	"github.com/cityhunteur/weather-service/internal/config"
+	"github.com/cityhunteur/weather-service/internal/cors"
 	"github.com/cityhunteur/weather-service/internal/handler"
+	"github.com/cityhunteur/weather-service/internal/health"
+	"github.com/cityhunteur/weather-service/internal/logging"
+	"github.com/cityhunteur/weather-service/internal/metrics"
 	"github.com/cityhunteur/weather-service/internal/pkg/openstreetmap"
 	"github.com/cityhunteur/weather-service/internal/pkg/weathergov"
+	"github.com/cityhunteur/weather-service/internal/ratelimit"
+	"github.com/cityhunteur/weather-service/internal/tlsconfig"
+	"github.com/cityhunteur/weather-service/internal/tracing"
+	"github.com/cityhunteur/weather-service/internal/usage"
 
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.uber.org/zap"
 )
 
+const (
+	serviceName = "weather-service"
+
+	// places and grid points of a city almost never change, so lookups are
+	// cached far longer than forecasts; aliases resolve to grid points, so
+	// they are kept as long as points
+	placeTTL  = 30 * 24 * time.Hour
+	pointsTTL = 7 * 24 * time.Hour
+	aliasTTL  = pointsTTL
+
+	cacheJanitorInterval = time.Minute
+
+	// aliasSnapshotSuffix is appended to the path of the cache snapshot to
+	// name the snapshot of the aliases
+	aliasSnapshotSuffix = ".aliases"
+
+	// jwksTimeout bounds the fetches of the JWKS, which block the requests
+	// authenticated by bearer JWTs naming a key not cached yet
+	jwksTimeout = 5 * time.Second
+
+	rateLimitJanitorInterval = time.Minute
+	// usagePruneInterval is the interval at which the usage beyond its
+	// retention is dropped, whether it is saved or not
+	usagePruneInterval = time.Hour
+)
+
 var logger *zap.SugaredLogger
 
+// forecastCache is a forecast cache which can be managed by operators.
+type forecastCache interface {
+	handler.Cache
+	handler.CacheAdmin
+}
+
 func main() {
-	flag.Parse()
+	cfg, opts, err := config.Load(os.Args[0], os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if opts.PrintConfig {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			log.Fatalf("Failed to print config: %v", err)
+		}
+		return
+	}
 
-	zlog, err := zap.NewProduction()
+	// the level is valid once the config is validated
+	level, _ := zap.ParseAtomicLevel(cfg.Log.Level)
+	zcfg := zap.NewProductionConfig()
+	zcfg.Level = level
+	zlog, err := zcfg.Build()
 	if err != nil {
 		log.Fatalf("Failed to initialise logger: %v", err)
 	}
 	defer func() { _ = zlog.Sync() }()
 	logger = zlog.Sugar()
 
-	osmClient := openstreetmap.NewClient(http.DefaultClient)
-	wgClient := weathergov.NewClient(http.DefaultClient)
-	store := cache.NewStore()
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing.Exporter, serviceName)
+	if err != nil {
+		log.Fatalf("Failed to initialise tracing: %v", err)
+	}
 
-	h := handler.NewGetForecastHandler(logger, osmClient, wgClient, store)
+	m := metrics.New()
+	osmHealth := health.NewUpstream("openstreetmap")
+	wgHealth := health.NewUpstream("weathergov")
+	// URLs are valid once the config is validated
+	osmURL, _ := url.Parse(cfg.Upstream.OpenStreetMapURL)
+	wgURL, _ := url.Parse(cfg.Upstream.WeatherGovURL)
+	// the timeout is applied below the health tracking, so that calls timing
+	// out count as upstream failures
+	timeout := newUpstreamTimeout(cfg.Upstream.Timeout)
+	osmClient := m.InstrumentOpenStreetMap(openstreetmap.NewClient(&http.Client{
+		Transport: osmHealth.Transport(usage.Transport(timeout.Transport(tracing.NewTransport(nil)))),
+	}, openstreetmap.WithBaseURL(osmURL)))
+	wgClient := m.InstrumentWeatherGov(weathergov.NewClient(&http.Client{
+		Transport: wgHealth.Transport(usage.Transport(timeout.Transport(tracing.NewTransport(nil)))),
+	}, weathergov.WithBaseURL(wgURL)))
+	store, closeStore, err := newForecastCache(&cfg.Cache)
+	if err != nil {
+		log.Fatalf("Failed to create cache: %v", err)
+	}
+
+	aliasCache := cache.NewStore[string, string](
+		cache.WithTTL(aliasTTL),
+		cache.WithJanitor(cacheJanitorInterval),
+	)
+	placeCache := cache.NewStore[string, *openstreetmap.Place](
+		cache.WithTTL(placeTTL),
+		cache.WithJanitor(cacheJanitorInterval),
+	)
+	pointsCache := cache.NewStore[string, *weathergov.Points](
+		cache.WithTTL(pointsTTL),
+		cache.WithJanitor(cacheJanitorInterval),
+	)
+	m.RegisterCache("forecast", store)
+	m.RegisterCache("alias", aliasCache)
+	m.RegisterCache("place", placeCache)
+	m.RegisterCache("points", pointsCache)
+
+	// warm the memory cache from the last snapshot, if any, and keep saving
+	// it; aliases are saved alongside, so that cities resolve to the restored
+	// forecasts without looking them up upstream
+	snapshotCtx, stopSnapshots := context.WithCancel(context.Background())
+	defer stopSnapshots()
+	var snapshots []snapshot
+	var snapshotting sync.WaitGroup
+	if s, ok := store.(*cache.ForecastStore); ok && cfg.Cache.Snapshot.Path != "" {
+		snapshots = []snapshot{
+			{store: s, path: cfg.Cache.Snapshot.Path},
+			{store: aliasCache, path: cfg.Cache.Snapshot.Path + aliasSnapshotSuffix},
+		}
+		for _, s := range snapshots {
+			n, err := s.store.LoadSnapshot(s.path)
+			if err != nil {
+				logger.Warnw("Failed to restore cache snapshot, starting with an empty cache", "error", err, "path", s.path)
+			} else {
+				logger.Infow("Restored cache snapshot", "entries", n, "path", s.path)
+			}
+		}
+
+		snapshotting.Add(1)
+		go func() {
+			defer snapshotting.Done()
+			runSnapshots(snapshotCtx, snapshots, cfg.Cache.Snapshot.Interval)
+		}()
+	}
+
+	// keep dropping the usage of consumers beyond its retention; restore it,
+	// if persisted, and keep saving it
+	tracker := usage.NewTracker(usageQuota(&cfg.Usage))
+	snapshotting.Add(1)
+	go func() {
+		defer snapshotting.Done()
+		runUsagePrunes(snapshotCtx, tracker, cfg.Usage.Retention)
+	}()
+	if cfg.Usage.Path != "" {
+		if err := tracker.Load(cfg.Usage.Path); err != nil {
+			logger.Warnw("Failed to restore usage, starting with no usage", "error", err, "path", cfg.Usage.Path)
+		}
+		snapshotting.Add(1)
+		go func() {
+			defer snapshotting.Done()
+			runUsageSaves(snapshotCtx, tracker, &cfg.Usage)
+		}()
+	}
+
+	handlerOpts := []handler.Option{
+		handler.WithAliasCache(aliasCache),
+		handler.WithPlaceCache(placeCache),
+		handler.WithPointsCache(pointsCache),
+		handler.WithTimeout(cfg.Handler.Timeout),
+		handler.WithCountry(cfg.Handler.Country),
+	}
+	// shed the requests calling upstream APIs beyond the concurrency limit,
+	// while still serving cached forecasts
+	if cfg.Admission.Enabled {
+		limiter := newAdmission(&cfg.Admission)
+		m.RegisterAdmission(limiter)
+		handlerOpts = append(handlerOpts, handler.WithAdmission(limiter))
+	}
+	h := handler.NewGetForecastHandler(logger, osmClient, wgClient, store, handlerOpts...)
 	if err != nil {
 		log.Fatalf("Failed to create handler: %v", err)
 	}
 
-	// setup API routes
-	router := gin.Default()
-	router.GET("/v1/weather", h.GetForecast)
+	// cache errors are served as misses, so an unreachable cache only degrades
+	// readiness rather than taking every replica out of rotation at once
+	checker := health.NewChecker()
+	checker.AddCheck("cache", pingCache(store), false)
+	checker.AddCheck("openstreetmap", osmHealth.Check, false)
+	checker.AddCheck("weathergov", wgHealth.Check, false)
+
+	// setup API routes; probes are registered first so that they are neither
+	// logged, traced nor counted
+	router := gin.New()
+	// the client IP keys the anonymous rate limit, so X-Forwarded-For is only
+	// trusted from the configured proxies; they are valid once the config is
+	// validated
+	_ = router.SetTrustedProxies(cfg.Server.Proxies())
+	checker.RegisterRoutes(router)
+	if cfg.Server.TLS.ClientCAFile != "" {
+		// probes are served without a client certificate, as kubelets and
+		// load balancers seldom present one
+		router.Use(tlsconfig.RequireClientCert())
+	}
+	router.Use(
+		otelgin.Middleware(serviceName),
+		logging.Middleware(logger),
+		logging.Recovery(logger),
+		m.Middleware(),
+	)
+	// API routes require an API key or a bearer JWT when either is configured
+	var keys *auth.APIKeys
+	var authenticators []gin.HandlerFunc
+	if cfg.Auth.APIKeysFile != "" {
+		keys, err = auth.LoadAPIKeys(cfg.Auth.APIKeysFile)
+		if err != nil {
+			logger.Fatalw("Failed to load API keys", "error", err)
+		}
+		authenticators = append(authenticators, auth.AuthenticateAPIKey(keys, logger))
+	}
+	var jwtValidator *auth.JWTValidator
+	if cfg.Auth.JWT.Enabled() {
+		jwtValidator, err = newJWTValidator(&cfg.Auth.JWT)
+		if err != nil {
+			logger.Fatalw("Failed to load JWT keys", "error", err)
+		}
+		authenticators = append(authenticators, auth.AuthenticateJWT(jwtValidator, cfg.Auth.JWT.ReadScope, logger))
+	}
+	api := router.Group("/v1")
+	if cfg.CORS.Enabled() {
+		// the policy is valid once the config is validated
+		policy, _ := cors.New(cfg.CORS.Policy())
+		policy.Register(api)
+	}
+	// requests with missing or invalid credentials are rejected by Required
+	// after the limiter, so that they are limited by client IP
+	api.Use(authenticators...)
+	var limiter *ratelimit.Limiter
+	if cfg.RateLimit.Enabled {
+		buckets := ratelimit.NewMemoryStore(rateLimitJanitorInterval)
+		defer buckets.Close()
+		limiter = ratelimit.NewLimiter(buckets, rateLimits(&cfg.RateLimit))
+		api.Use(limiter.Middleware(logger))
+	}
+	if len(authenticators) > 0 {
+		api.Use(auth.Required())
+	}
+	api.Use(tracker.Middleware(logger))
+	api.GET("/weather", h.GetForecast)
+	router.GET("/metrics", gin.WrapH(m.Handler()))
+
+	// admin API routes are only served when a token or bearer JWTs are
+	// configured
+	var adminAuthenticators []gin.HandlerFunc
+	if token := os.Getenv("ADMIN_TOKEN"); token != "" {
+		adminAuthenticators = append(adminAuthenticators, auth.AuthenticateToken(token, logger))
+	}
+	if jwtValidator != nil {
+		adminAuthenticators = append(adminAuthenticators, auth.AuthenticateJWT(jwtValidator, cfg.Auth.JWT.AdminScope, logger))
+	}
+	if len(adminAuthenticators) > 0 {
+		admin := router.Group("/admin", append(adminAuthenticators, auth.Required())...)
+		handler.NewCacheAdminHandler(logger, store).RegisterRoutes(admin)
+		handler.NewUsageAdminHandler(tracker).RegisterRoutes(admin)
+	}
 
 	srv := &http.Server{
-		Addr:              ":8080",
+		Addr:              cfg.Server.Addr,
 		Handler:           router,
-		ReadHeaderTimeout: 5 * time.Second,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+	}
+	serve := srv.ListenAndServe
+	if cfg.Server.TLS.Enabled() {
+		tlsCfg, stopReloading, err := newTLSConfig(&cfg.Server.TLS)
+		if err != nil {
+			logger.Fatalw("Failed to configure TLS", "error", err)
+		}
+		defer stopReloading()
+		srv.TLSConfig = tlsCfg
+		serve = func() error {
+			// the certificate is served by the TLS config
+			return srv.ListenAndServeTLS("", "")
+		}
 	}
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := serve(); err != nil && err != http.ErrServerClosed {
 			logger.Fatalf("listen: %s\n", err)
 		}
 	}()
 
+	// reload the config on SIGHUP until asked to shut down
+	r := &reloader{
+		load:     loadConfig,
+		cfg:      cfg,
+		level:    level,
+		handler:  h,
+		upstream: timeout,
+		cache:    store,
+		keys:     keys,
+		limiter:  limiter,
+		usage:    tracker,
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	for running := true; running; {
+		select {
+		case <-hup:
+			r.reload()
+		case <-quit:
+			running = false
+		}
+	}
+	signal.Stop(hup)
+	logger.Infow("Draining traffic before shutting down", "delay", cfg.Server.DrainDelay)
+	checker.Drain()
+	time.Sleep(cfg.Server.DrainDelay)
 	logger.Infof("Shutting down server...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
 		logger.Fatalf("Server forced to shutdown: %v", err)
 	}
+	h.Wait()
+	stopSnapshots()
+	snapshotting.Wait()
+	saveSnapshots(snapshots)
+	if cfg.Usage.Path != "" {
+		if err := tracker.Save(cfg.Usage.Path); err != nil {
+			logger.Errorw("Failed to save usage", "error", err, "path", cfg.Usage.Path)
+		}
+	}
+	closeStore()
+	aliasCache.Close()
+	placeCache.Close()
+	pointsCache.Close()
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Errorw("Failed to flush trace spans", "error", err)
+	}
 
 	logger.Infof("Server exiting")
 }
+
+// newForecastCache creates the forecast cache for the configured backend. The
+// returned function releases the resources held by the cache.
+func newForecastCache(cfg *config.Cache) (forecastCache, func(), error) {
+	opts := []cache.Option{
+		cache.WithTTL(cfg.TTL),
+		cache.WithGrace(cfg.Grace),
+	}
+
+	switch cfg.Backend {
+	case "memory":
+		store := cache.NewSizedStore(cache.ForecastSize, append(opts,
+			cache.WithCapacity(cfg.Capacity),
+			cache.WithMaxBytes(int64(cfg.MaxBytes)),
+			cache.WithJanitor(cacheJanitorInterval),
+		)...)
+		return store, store.Close, nil
+	case "redis":
+		client := redis.NewClient(&redis.Options{
+			Addr:     cfg.Redis.Addr,
+			Password: os.Getenv("REDIS_PASSWORD"),
+			DB:       cfg.Redis.DB,
+			PoolSize: cfg.Redis.PoolSize,
+			// honour the timeouts of the store and of admin requests
+			ContextTimeoutEnabled: true,
+		})
+		store := cache.NewRedisStore(client, logger, append(opts, cache.WithPrefix(cfg.Redis.Prefix))...)
+		if cfg.L1.Capacity <= 0 {
+			return store, func() { _ = client.Close() }, nil
+		}
+
+		l1 := cache.NewStore[string, *v1.Forecast](
+			cache.WithTTL(cfg.L1.TTL),
+			cache.WithCapacity(cfg.L1.Capacity),
+			cache.WithJanitor(cacheJanitorInterval),
+		)
+		closeTiers := func() {
+			l1.Close()
+			_ = client.Close()
+		}
+		return cache.NewTiered(l1, store, cfg.TTL, cfg.L1.TTL), closeTiers, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown cache backend %q", cfg.Backend)
+	}
+}
+
+// newTLSConfig creates the TLS config of the server, reloading its certificate
+// when the files change until the returned function is called.
+func newTLSConfig(cfg *config.TLS) (*tls.Config, func(), error) {
+	reloader, err := tlsconfig.NewReloader(cfg.CertFile, cfg.KeyFile, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	tlsCfg, err := tlsconfig.New(&tlsconfig.Config{
+		MinVersion:   cfg.MinVersion,
+		ClientCAFile: cfg.ClientCAFile,
+	}, reloader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go reloader.Run(ctx, cfg.ReloadInterval)
+	return tlsCfg, cancel, nil
+}
+
+// newJWTValidator creates the validator of bearer JWTs, verified by the keys
+// of the JWKS URL or of the key file.
+func newJWTValidator(cfg *config.JWT) (*auth.JWTValidator, error) {
+	var keys auth.KeySet
+	if cfg.JWKSURL != "" {
+		keys = auth.NewRemoteJWKS(&http.Client{
+			Transport: tracing.NewTransport(nil),
+			Timeout:   jwksTimeout,
+		}, cfg.JWKSURL, cfg.JWKSRefreshInterval)
+	} else {
+		var err error
+		keys, err = auth.LoadKeyFile(cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return auth.NewJWTValidator(keys, cfg.Issuer, cfg.Audience), nil
+}
+
+// newAdmission creates the limiter admitting the requests calling upstream
+// APIs.
+func newAdmission(cfg *config.Admission) *admission.Limiter {
+	return admission.New(
+		admission.WithLimits(cfg.InitialLimit, cfg.MinLimit, cfg.MaxLimit),
+		admission.WithTargetLatency(cfg.TargetLatency),
+		admission.WithQueue(cfg.QueueSize, cfg.QueueTimeout),
+	)
+}
+
+// rateLimits returns the limits of the rate limit tiers.
+func rateLimits(cfg *config.RateLimit) ratelimit.Limits {
+	return ratelimit.Limits{
+		Consumer:  ratelimit.Per(cfg.ConsumerRequests, cfg.Period, cfg.ConsumerBurst),
+		Anonymous: ratelimit.Per(cfg.AnonymousRequests, cfg.Period, cfg.AnonymousBurst),
+	}
+}
+
+// usageQuota returns the monthly quota of the consumers.
+func usageQuota(cfg *config.Usage) usage.Quota {
+	return usage.Quota{Requests: int64(cfg.MonthlyQuota), Block: cfg.QuotaMode == "block"}
+}
+
+// pingCache returns a check of the connection to the backend of store. The
+// memory backend is always healthy.
+func pingCache(store forecastCache) health.CheckFunc {
+	if p, ok := store.(interface{ Ping(context.Context) error }); ok {
+		return p.Ping
+	}
+	return func(context.Context) error { return nil }
+}
+
+// snapshot is a cache store saved to and restored from a file.
+type snapshot struct {
+	store interface {
+		SaveSnapshot(path string) error
+		LoadSnapshot(path string) (int, error)
+	}
+	path string
+}
+
+// runSnapshots saves the snapshots at every interval until ctx is done.
+func runSnapshots(ctx context.Context, snapshots []snapshot, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			saveSnapshots(snapshots)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// saveSnapshots saves the snapshots, logging failures.
+func saveSnapshots(snapshots []snapshot) {
+	for _, s := range snapshots {
+		if err := s.store.SaveSnapshot(s.path); err != nil {
+			logger.Errorw("Failed to save cache snapshot", "error", err, "path", s.path)
+		}
+	}
+}
+
+// runUsagePrunes drops the usage beyond retention every usagePruneInterval
+// until ctx is done.
+func runUsagePrunes(ctx context.Context, tracker *usage.Tracker, retention time.Duration) {
+	ticker := time.NewTicker(usagePruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			tracker.Prune(time.Now().Add(-retention))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runUsageSaves saves the usage at every save interval until ctx is done.
+func runUsageSaves(ctx context.Context, tracker *usage.Tracker, cfg *config.Usage) {
+	ticker := time.NewTicker(cfg.SaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := tracker.Save(cfg.Path); err != nil {
+				logger.Errorw("Failed to save usage", "error", err, "path", cfg.Path)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
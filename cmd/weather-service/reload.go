@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/cityhunteur/weather-service/internal/auth"
+	"github.com/cityhunteur/weather-service/internal/config"
+	"github.com/cityhunteur/weather-service/internal/handler"
+	"github.com/cityhunteur/weather-service/internal/ratelimit"
+	"github.com/cityhunteur/weather-service/internal/usage"
+)
+
+// reloadable are the flags of the settings applied on SIGHUP. Other settings
+// require a restart.
+var reloadable = map[string]bool{
+	"log-level":        true,
+	"request-timeout":  true,
+	"upstream-timeout": true,
+	"cache-ttl":        true,
+	"cache-grace":      true,
+	"cache-l1-ttl":     true,
+
+	"ratelimit-period":             true,
+	"ratelimit-consumer-requests":  true,
+	"ratelimit-consumer-burst":     true,
+	"ratelimit-anonymous-requests": true,
+	"ratelimit-anonymous-burst":    true,
+
+	"usage-monthly-quota": true,
+	"usage-quota-mode":    true,
+}
+
+// reloader applies the settings which can change while serving.
+type reloader struct {
+	// load reads the configuration.
+	load func() (*config.Config, error)
+	// cfg is the configuration in effect.
+	cfg *config.Config
+
+	level    zap.AtomicLevel
+	handler  *handler.GetForecastHandler
+	upstream *upstreamTimeout
+	cache    forecastCache
+	// keys are the API keys, if required, reloaded from their file.
+	keys *auth.APIKeys
+	// limiter is the rate limiter, if enabled.
+	limiter *ratelimit.Limiter
+	usage   *usage.Tracker
+}
+
+// loadConfig reads the configuration from the command line, the environment
+// and the config file.
+func loadConfig() (*config.Config, error) {
+	cfg, _, err := config.Load(os.Args[0], os.Args[1:], os.LookupEnv)
+	return cfg, err
+}
+
+// reload reads the configuration and the API keys again, and applies the
+// reloadable settings which changed. An invalid configuration is rejected as
+// a whole, leaving the configuration in effect untouched.
+func (r *reloader) reload() {
+	cfg, err := r.load()
+	if err != nil {
+		logger.Errorw("Rejected invalid config, keeping the current one", "error", err)
+		return
+	}
+
+	applied, restart := r.apply(cfg)
+
+	if r.keys != nil {
+		if err := r.keys.Load(r.cfg.Auth.APIKeysFile); err != nil {
+			logger.Errorw("Rejected invalid API keys, keeping the current ones", "error", err)
+		} else {
+			logger.Infow("Reloaded API keys", "path", r.cfg.Auth.APIKeysFile)
+		}
+	}
+
+	if len(restart) > 0 {
+		logger.Warnw("Changed settings require a restart to apply", "settings", restart)
+	}
+	logger.Infow("Reloaded config", "applied", applied)
+}
+
+// apply applies the reloadable settings of cfg which differ from the
+// configuration in effect, and returns the flags of the settings applied and
+// of the changed settings which require a restart.
+func (r *reloader) apply(cfg *config.Config) (applied, restart []string) {
+	for _, name := range config.Changed(r.cfg, cfg) {
+		if reloadable[name] {
+			applied = append(applied, name)
+		} else {
+			restart = append(restart, name)
+		}
+	}
+
+	if r.cfg.Log.Level != cfg.Log.Level {
+		// the level is valid once the config is validated
+		_ = r.level.UnmarshalText([]byte(cfg.Log.Level))
+		r.cfg.Log.Level = cfg.Log.Level
+	}
+	if r.cfg.Handler.Timeout != cfg.Handler.Timeout {
+		r.handler.SetTimeout(cfg.Handler.Timeout)
+		r.cfg.Handler.Timeout = cfg.Handler.Timeout
+	}
+	if r.cfg.Upstream.Timeout != cfg.Upstream.Timeout {
+		r.upstream.Set(cfg.Upstream.Timeout)
+		r.cfg.Upstream.Timeout = cfg.Upstream.Timeout
+	}
+
+	// the TTLs apply to the entries stored from now on, and the grace window
+	// to all entries
+	if r.cfg.Cache.TTL != cfg.Cache.TTL {
+		if c, ok := r.cache.(interface{ SetTTL(time.Duration) }); ok {
+			c.SetTTL(cfg.Cache.TTL)
+		}
+		r.cfg.Cache.TTL = cfg.Cache.TTL
+	}
+	if r.cfg.Cache.Grace != cfg.Cache.Grace {
+		if c, ok := r.cache.(interface{ SetGrace(time.Duration) }); ok {
+			c.SetGrace(cfg.Cache.Grace)
+		}
+		r.cfg.Cache.Grace = cfg.Cache.Grace
+	}
+	if r.cfg.Cache.L1.TTL != cfg.Cache.L1.TTL {
+		if c, ok := r.cache.(interface{ SetL1TTL(time.Duration) }); ok {
+			c.SetL1TTL(cfg.Cache.L1.TTL)
+		}
+		r.cfg.Cache.L1.TTL = cfg.Cache.L1.TTL
+	}
+
+	if limits := rateLimits(&cfg.RateLimit); limits != rateLimits(&r.cfg.RateLimit) {
+		if r.limiter != nil {
+			r.limiter.SetLimits(limits)
+		}
+		// enabling rate limits requires a restart
+		enabled := r.cfg.RateLimit.Enabled
+		r.cfg.RateLimit = cfg.RateLimit
+		r.cfg.RateLimit.Enabled = enabled
+	}
+
+	if quota := usageQuota(&cfg.Usage); quota != usageQuota(&r.cfg.Usage) {
+		r.usage.SetQuota(quota)
+		r.cfg.Usage.MonthlyQuota = cfg.Usage.MonthlyQuota
+		r.cfg.Usage.QuotaMode = cfg.Usage.QuotaMode
+	}
+
+	return applied, restart
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	v1 "github.com/cityhunteur/weather-service/api/v1"
+	"github.com/cityhunteur/weather-service/internal/cache"
+	"github.com/cityhunteur/weather-service/internal/config"
+	"github.com/cityhunteur/weather-service/internal/handler"
+	"github.com/cityhunteur/weather-service/internal/ratelimit"
+	"github.com/cityhunteur/weather-service/internal/usage"
+)
+
+func TestMain(m *testing.M) {
+	logger = zap.NewNop().Sugar()
+	os.Exit(m.Run())
+}
+
+// loadArgs returns a function loading the configuration from args, which can
+// be changed before each reload.
+func loadArgs(args *[]string) func() (*config.Config, error) {
+	return func() (*config.Config, error) {
+		cfg, _, err := config.Load("weather-service", *args, func(string) (string, bool) { return "", false })
+		return cfg, err
+	}
+}
+
+// newTestReloader returns a reloader of the configuration loaded from args,
+// and its forecast cache.
+func newTestReloader(t *testing.T, args *[]string) (*reloader, *cache.ForecastStore) {
+	t.Helper()
+	load := loadArgs(args)
+	cfg, err := load()
+	require.NoError(t, err)
+
+	level, err := zap.ParseAtomicLevel(cfg.Log.Level)
+	require.NoError(t, err)
+	store := cache.NewStore[string, *v1.Forecast](cache.WithTTL(cfg.Cache.TTL), cache.WithGrace(cfg.Cache.Grace))
+	buckets := ratelimit.NewMemoryStore(time.Minute)
+	t.Cleanup(buckets.Close)
+	return &reloader{
+		load:     load,
+		cfg:      cfg,
+		level:    level,
+		handler:  handler.NewGetForecastHandler(logger, nil, nil, store),
+		upstream: newUpstreamTimeout(cfg.Upstream.Timeout),
+		cache:    store,
+		limiter:  ratelimit.NewLimiter(buckets, rateLimits(&cfg.RateLimit)),
+		usage:    usage.NewTracker(usageQuota(&cfg.Usage)),
+	}, store
+}
+
+func TestReloader_Apply(t *testing.T) {
+	t.Parallel()
+	args := []string{"-ratelimit-enabled"}
+	r, store := newTestReloader(t, &args)
+
+	args = append(args,
+		"-log-level=debug",
+		"-request-timeout=5s",
+		"-upstream-timeout=2s",
+		"-cache-ttl=10m",
+		"-cache-grace=1m",
+		"-cache-l1-ttl=30s",
+		"-ratelimit-consumer-requests=100",
+		"-usage-monthly-quota=1000",
+	)
+	cfg, err := r.load()
+	require.NoError(t, err)
+	applied, restart := r.apply(cfg)
+
+	assert.Equal(t, []string{
+		"request-timeout",
+		"upstream-timeout",
+		"cache-ttl",
+		"cache-grace",
+		"cache-l1-ttl",
+		"log-level",
+		"ratelimit-consumer-requests",
+		"usage-monthly-quota",
+	}, applied)
+	assert.Empty(t, restart)
+	assert.Equal(t, cfg, r.cfg)
+	assert.Equal(t, zapcore.DebugLevel, r.level.Level())
+	assert.Equal(t, 2*time.Second, r.upstream.Get())
+
+	store.Set("new york", &v1.Forecast{Name: "New York"}, 0)
+	e, err := store.Peek(context.Background(), "new york")
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, e.ExpiresAt.Sub(e.StoredAt))
+}
+
+func TestReloader_Apply_RestartRequired(t *testing.T) {
+	t.Parallel()
+	args := []string{"-ratelimit-enabled"}
+	r, _ := newTestReloader(t, &args)
+	want, err := r.load()
+	require.NoError(t, err)
+
+	args = []string{"-addr=:9090", "-cache-capacity=10", "-ratelimit-enabled=false"}
+	cfg, err := r.load()
+	require.NoError(t, err)
+	applied, restart := r.apply(cfg)
+
+	assert.Empty(t, applied)
+	assert.Equal(t, []string{"addr", "cache-capacity", "ratelimit-enabled"}, restart)
+	assert.Equal(t, want, r.cfg)
+}
+
+func TestReloader_Reload_RejectsInvalidConfig(t *testing.T) {
+	t.Parallel()
+	args := []string{"-ratelimit-enabled"}
+	r, _ := newTestReloader(t, &args)
+	want, err := r.load()
+	require.NoError(t, err)
+
+	// valid settings are not applied either
+	args = append(args, "-log-level=debug", "-upstream-timeout=2s", "-cache-ttl=0")
+	r.reload()
+
+	assert.Equal(t, want, r.cfg)
+	assert.Equal(t, zapcore.InfoLevel, r.level.Level())
+	assert.Equal(t, want.Upstream.Timeout, r.upstream.Get())
+}
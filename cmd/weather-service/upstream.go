@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// upstreamTimeout bounds each call to the upstream APIs, and can be changed
+// while serving.
+type upstreamTimeout struct {
+	d atomic.Int64
+}
+
+// newUpstreamTimeout creates a new upstreamTimeout of d.
+func newUpstreamTimeout(d time.Duration) *upstreamTimeout {
+	t := &upstreamTimeout{}
+	t.Set(d)
+	return t
+}
+
+// Set changes the timeout of the calls made from now on.
+func (t *upstreamTimeout) Set(d time.Duration) {
+	t.d.Store(int64(d))
+}
+
+// Get returns the timeout of the calls.
+func (t *upstreamTimeout) Get() time.Duration {
+	return time.Duration(t.d.Load())
+}
+
+// Transport returns an http.RoundTripper bounding the calls made through base,
+// including reading their response body, by the timeout. A nil base means
+// http.DefaultTransport.
+func (t *upstreamTimeout) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		ctx, cancel := context.WithTimeout(req.Context(), t.Get())
+		resp, err := base.RoundTrip(req.WithContext(ctx))
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+		return resp, nil
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// cancelBody is a response body releasing the context of its call once
+// closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpstreamTimeout_Transport(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		}
+		_, _ = io.WriteString(w, "ok")
+	}))
+	defer srv.Close()
+
+	timeout := newUpstreamTimeout(time.Second)
+	client := &http.Client{Transport: timeout.Transport(nil)}
+
+	// the body is still readable once the call returned
+	resp, err := client.Get(srv.URL + "/fast")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", string(body))
+	require.NoError(t, resp.Body.Close())
+
+	timeout.Set(50 * time.Millisecond)
+	_, err = client.Get(srv.URL + "/slow")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
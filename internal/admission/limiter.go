@@ -0,0 +1,213 @@
+// Package admission bounds the number of requests doing expensive work
+// concurrently, shedding the requests beyond an adaptive limit.
+package admission
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultInitialLimit  = 20
+	defaultMinLimit      = 5
+	defaultMaxLimit      = 100
+	defaultTargetLatency = 2 * time.Second
+	defaultQueueSize     = 50
+	defaultQueueTimeout  = 500 * time.Millisecond
+
+	// backoff is the factor the limit is multiplied by when requests are
+	// slower than the target latency.
+	backoff = 0.9
+)
+
+// ErrOverloaded is returned by Acquire when a request is shed, because the
+// queue is full or the request waited for the queue timeout.
+var ErrOverloaded = errors.New("overloaded")
+
+// Limiter bounds the number of requests in flight with an AIMD limit: the
+// limit grows by one per limit requests completed within the target latency
+// while it is reached, and shrinks by a tenth at most once per target latency
+// while requests are slower. Requests beyond the limit wait in a bounded FIFO
+// queue up to the queue timeout. It is safe for concurrent use.
+type Limiter struct {
+	options
+
+	limit    float64
+	inFlight int
+	// queue holds the channels of the waiting requests, closed once
+	// admitted.
+	queue *list.List
+	// decreasedAt is the time the limit last shrank.
+	decreasedAt time.Time
+	rejected    uint64
+	now         func() time.Time
+
+	mu sync.Mutex
+}
+
+type options struct {
+	initialLimit  int
+	minLimit      int
+	maxLimit      int
+	targetLatency time.Duration
+	queueSize     int
+	queueTimeout  time.Duration
+}
+
+// Option configures a Limiter.
+type Option func(o *options)
+
+// WithLimits sets the initial limit and the bounds it adapts within.
+func WithLimits(initial, minimum, maximum int) Option {
+	return func(o *options) {
+		o.initialLimit, o.minLimit, o.maxLimit = initial, minimum, maximum
+	}
+}
+
+// WithTargetLatency sets the latency of requests above which the limit
+// shrinks.
+func WithTargetLatency(d time.Duration) Option {
+	return func(o *options) {
+		o.targetLatency = d
+	}
+}
+
+// WithQueue sets the number of requests waiting for the limit, and the
+// duration they wait before being shed.
+func WithQueue(size int, timeout time.Duration) Option {
+	return func(o *options) {
+		o.queueSize, o.queueTimeout = size, timeout
+	}
+}
+
+// Stats are the state of a Limiter.
+type Stats struct {
+	Limit    int
+	InFlight int
+	Queued   int
+	// Rejected is the number of requests shed since the start.
+	Rejected uint64
+}
+
+// New creates a new Limiter.
+func New(opts ...Option) *Limiter {
+	o := options{
+		initialLimit:  defaultInitialLimit,
+		minLimit:      defaultMinLimit,
+		maxLimit:      defaultMaxLimit,
+		targetLatency: defaultTargetLatency,
+		queueSize:     defaultQueueSize,
+		queueTimeout:  defaultQueueTimeout,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Limiter{
+		options: o,
+		limit:   float64(o.initialLimit),
+		queue:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// Acquire admits a request, waiting in the queue if the limit is reached. The
+// returned function must be called once the request completes. ErrOverloaded
+// is returned if the request is shed, and the error of ctx if it is done while
+// waiting.
+func (l *Limiter) Acquire(ctx context.Context) (func(), error) {
+	l.mu.Lock()
+	if l.inFlight < int(l.limit) && l.queue.Len() == 0 {
+		l.inFlight++
+		release := l.releaseFunc(l.now(), l.inFlight >= int(l.limit))
+		l.mu.Unlock()
+		return release, nil
+	}
+	if l.queue.Len() >= l.queueSize {
+		l.rejected++
+		l.mu.Unlock()
+		return nil, ErrOverloaded
+	}
+	admitted := make(chan struct{})
+	el := l.queue.PushBack(admitted)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(l.queueTimeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-admitted:
+		// admitted requests are counted in flight by admit
+		return l.releaseFunc(l.now(), true), nil
+	case <-timer.C:
+		err = ErrOverloaded
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	select {
+	case <-admitted:
+		// admitted while giving up; the slot is released right away
+		l.inFlight--
+		l.admit()
+	default:
+		l.queue.Remove(el)
+	}
+	if errors.Is(err, ErrOverloaded) {
+		l.rejected++
+	}
+	return nil, err
+}
+
+// Stats returns the state of the limiter.
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Stats{
+		Limit:    int(l.limit),
+		InFlight: l.inFlight,
+		Queued:   l.queue.Len(),
+		Rejected: l.rejected,
+	}
+}
+
+// releaseFunc returns the function releasing a request admitted at start,
+// adapting the limit to its latency. saturated reports whether the limit was
+// reached when it was admitted.
+func (l *Limiter) releaseFunc(start time.Time, saturated bool) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			now := l.now()
+
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			l.inFlight--
+			switch {
+			case now.Sub(start) > l.targetLatency:
+				if now.Sub(l.decreasedAt) >= l.targetLatency {
+					l.limit = math.Max(float64(l.minLimit), l.limit*backoff)
+					l.decreasedAt = now
+				}
+			case saturated:
+				l.limit = math.Min(float64(l.maxLimit), l.limit+1/l.limit)
+			}
+			l.admit()
+		})
+	}
+}
+
+// admit admits the waiting requests within the limit. It must be called with
+// mu held.
+func (l *Limiter) admit() {
+	for l.queue.Len() > 0 && l.inFlight < int(l.limit) {
+		l.inFlight++
+		close(l.queue.Remove(l.queue.Front()).(chan struct{}))
+	}
+}
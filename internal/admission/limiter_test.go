@@ -0,0 +1,109 @@
+package admission
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter_Acquire(t *testing.T) {
+	t.Parallel()
+	l := New(WithLimits(2, 1, 4), WithQueue(1, time.Minute))
+
+	release1, err := l.Acquire(context.Background())
+	require.NoError(t, err)
+	release2, err := l.Acquire(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Limit: 2, InFlight: 2}, l.Stats())
+
+	// the third request waits for a slot, and the fourth is shed
+	admitted := make(chan func())
+	go func() {
+		release, err := l.Acquire(context.Background())
+		assert.NoError(t, err)
+		admitted <- release
+	}()
+	require.Eventually(t, func() bool { return l.Stats().Queued == 1 }, time.Second, time.Millisecond)
+	_, err = l.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrOverloaded)
+
+	release1()
+	// releasing twice has no effect
+	release1()
+	release3 := <-admitted
+	assert.Equal(t, 2, l.Stats().InFlight)
+	release2()
+	release3()
+	assert.Equal(t, 0, l.Stats().InFlight)
+	assert.Equal(t, uint64(1), l.Stats().Rejected)
+}
+
+func TestLimiter_AcquireTimeout(t *testing.T) {
+	t.Parallel()
+	l := New(WithLimits(1, 1, 1), WithQueue(1, 10*time.Millisecond))
+	release, err := l.Acquire(context.Background())
+	require.NoError(t, err)
+	defer release()
+
+	_, err = l.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrOverloaded)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = l.Acquire(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// only the requests waiting for the queue timeout are shed
+	assert.Equal(t, Stats{Limit: 1, InFlight: 1, Rejected: 1}, l.Stats())
+}
+
+func TestLimiter_Adapt(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2023, 7, 31, 12, 0, 0, 0, time.UTC)
+	l := New(WithLimits(2, 1, 3), WithTargetLatency(time.Second), WithQueue(0, 0))
+	l.now = func() time.Time { return now }
+
+	// the limit grows by one once limit requests complete while it is reached
+	for i := 0; i < 4; i++ {
+		release1, err := l.Acquire(context.Background())
+		require.NoError(t, err)
+		release2, err := l.Acquire(context.Background())
+		require.NoError(t, err)
+		release1()
+		release2()
+	}
+	assert.Equal(t, 3, l.Stats().Limit)
+
+	// the limit does not grow while it is not reached, nor above the maximum
+	for i := 0; i < 6; i++ {
+		release, err := l.Acquire(context.Background())
+		require.NoError(t, err)
+		release()
+	}
+	assert.Equal(t, 3, l.Stats().Limit)
+
+	// slow requests shrink the limit at most once per target latency
+	var releases []func()
+	for i := 0; i < 3; i++ {
+		release, err := l.Acquire(context.Background())
+		require.NoError(t, err)
+		releases = append(releases, release)
+	}
+	now = now.Add(2 * time.Second)
+	for _, release := range releases {
+		release()
+	}
+	assert.Equal(t, 2, l.Stats().Limit)
+
+	// down to the minimum
+	for i := 0; i < 10; i++ {
+		release, err := l.Acquire(context.Background())
+		require.NoError(t, err)
+		now = now.Add(2 * time.Second)
+		release()
+	}
+	assert.Equal(t, 1, l.Stats().Limit)
+}
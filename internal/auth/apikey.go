@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// APIKeyHeader is the header carrying the API key of a request.
+	APIKeyHeader = "X-API-Key"
+
+	// MethodAPIKey is the method of identities authenticated by an API key.
+	MethodAPIKey = "api-key"
+
+	// allRoutes allows a key on every route.
+	allRoutes = "*"
+)
+
+// APIKey is an API key, stored as the SHA-256 hash of the key.
+type APIKey struct {
+	Name string `yaml:"name"`
+	// SHA256 is the hex encoded SHA-256 hash of the key.
+	SHA256 string `yaml:"sha256"`
+	// Routes are the routes the key is allowed on, e.g. /v1/weather, or * for
+	// every route.
+	Routes  []string `yaml:"routes"`
+	Enabled bool     `yaml:"enabled"`
+}
+
+// allows reports whether k is allowed on route.
+func (k *APIKey) allows(route string) bool {
+	for _, r := range k.Routes {
+		if r == allRoutes || r == route {
+			return true
+		}
+	}
+	return false
+}
+
+// keysFile is the format of the API keys file.
+type keysFile struct {
+	Keys []*APIKey `yaml:"keys"`
+}
+
+// APIKeys holds the API keys by hash. It is safe for concurrent use, and can
+// be reloaded while serving.
+type APIKeys struct {
+	keys atomic.Pointer[map[[sha256.Size]byte]*APIKey]
+}
+
+// NewAPIKeys creates a new APIKeys holding keys.
+func NewAPIKeys(keys []*APIKey) (*APIKeys, error) {
+	k := &APIKeys{}
+	if err := k.Set(keys); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// LoadAPIKeys creates a new APIKeys holding the keys of the YAML file at path.
+func LoadAPIKeys(path string) (*APIKeys, error) {
+	k := &APIKeys{}
+	if err := k.Load(path); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Load replaces the keys with the keys of the YAML file at path. The keys are
+// left untouched if the file is invalid.
+func (k *APIKeys) Load(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading API keys file: %w", err)
+	}
+	var f keysFile
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return fmt.Errorf("parsing API keys file %s: %w", path, err)
+	}
+	return k.Set(f.Keys)
+}
+
+// Set replaces the keys.
+func (k *APIKeys) Set(keys []*APIKey) error {
+	byHash := make(map[[sha256.Size]byte]*APIKey, len(keys))
+	names := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if key.Name == "" {
+			return errors.New("API key without a name")
+		}
+		if names[key.Name] {
+			return fmt.Errorf("API key %s: duplicate name", key.Name)
+		}
+		names[key.Name] = true
+
+		var hash [sha256.Size]byte
+		if n, err := hex.Decode(hash[:], []byte(key.SHA256)); err != nil || n != sha256.Size {
+			return fmt.Errorf("API key %s: invalid SHA-256 hash", key.Name)
+		}
+		if _, found := byHash[hash]; found {
+			return fmt.Errorf("API key %s: duplicate hash", key.Name)
+		}
+		byHash[hash] = key
+	}
+	k.keys.Store(&byHash)
+	return nil
+}
+
+// Lookup returns the key matching raw, if any.
+func (k *APIKeys) Lookup(raw string) (*APIKey, bool) {
+	key, found := (*k.keys.Load())[sha256.Sum256([]byte(raw))]
+	return key, found
+}
+
+// HashAPIKey returns the hex encoded SHA-256 hash of raw, as stored in the API
+// keys file.
+func HashAPIKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuthenticateAPIKey returns a gin middleware authenticating requests carrying
+// an API key in the X-API-Key header, unless already authenticated. Unknown or
+// disabled keys are rejected by Required, as are keys not allowed on the
+// route. Requests without an API key are passed on, to be authenticated
+// otherwise or rejected by Required.
+func AuthenticateAPIKey(keys *APIKeys, logger *zap.SugaredLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := c.GetHeader(APIKeyHeader)
+		if raw == "" || attempted(c) {
+			c.Next()
+			return
+		}
+		key, found := keys.Lookup(raw)
+		if !found || !key.Enabled {
+			reject(c, http.StatusUnauthorized, "Invalid API key.", "")
+			c.Next()
+			return
+		}
+
+		authenticate(c, &Identity{Name: key.Name, Method: MethodAPIKey}, logger)
+		if !key.allows(c.FullPath()) {
+			reject(c, http.StatusForbidden, "API key not allowed on this route.", "")
+		}
+		c.Next()
+	}
+}
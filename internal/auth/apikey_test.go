@@ -0,0 +1,121 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/cityhunteur/weather-service/internal/auth"
+	"github.com/cityhunteur/weather-service/internal/logging"
+)
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	t.Parallel()
+	keys, err := auth.NewAPIKeys([]*auth.APIKey{
+		{Name: "mobile-app", SHA256: auth.HashAPIKey("mobile-secret"), Routes: []string{"/v1/weather"}, Enabled: true},
+		{Name: "dashboard", SHA256: auth.HashAPIKey("dashboard-secret"), Routes: []string{"/v1/other"}, Enabled: true},
+		{Name: "partner", SHA256: auth.HashAPIKey("partner-secret"), Routes: []string{"*"}, Enabled: false},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		key            string
+		wantStatusCode int
+		wantConsumer   string
+	}{
+		{name: "missing key", wantStatusCode: http.StatusUnauthorized},
+		{name: "unknown key", key: "guess", wantStatusCode: http.StatusUnauthorized},
+		{name: "disabled key", key: "partner-secret", wantStatusCode: http.StatusUnauthorized},
+		{name: "route not allowed", key: "dashboard-secret", wantStatusCode: http.StatusForbidden, wantConsumer: "dashboard"},
+		{name: "allowed", key: "mobile-secret", wantStatusCode: http.StatusOK, wantConsumer: "mobile-app"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			core, logs := observer.New(zapcore.InfoLevel)
+			logger := zap.New(core).Sugar()
+
+			var got *auth.Identity
+			resp := httptest.NewRecorder()
+			_, router := gin.CreateTestContext(resp)
+			router.Use(logging.Middleware(logger))
+			router.GET("/v1/weather", auth.AuthenticateAPIKey(keys, logger), auth.Required(), func(c *gin.Context) {
+				got, _ = auth.FromContext(c.Request.Context())
+				c.Status(http.StatusOK)
+			})
+			req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/v1/weather?city=chicago", nil)
+			if tt.key != "" {
+				req.Header.Set(auth.APIKeyHeader, tt.key)
+			}
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.wantStatusCode, resp.Code)
+			if tt.wantStatusCode == http.StatusOK {
+				require.NotNil(t, got)
+				assert.Equal(t, &auth.Identity{Name: tt.wantConsumer, Method: auth.MethodAPIKey}, got)
+			}
+
+			// the access log names the consumer once authenticated
+			access := logs.FilterMessage("Handled request").All()
+			require.Len(t, access, 1)
+			if tt.wantConsumer != "" {
+				assert.Equal(t, tt.wantConsumer, access[0].ContextMap()["consumer"])
+			} else {
+				assert.NotContains(t, access[0].ContextMap(), "consumer")
+			}
+		})
+	}
+}
+
+func TestAPIKeys_Load(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	write := func(content string) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+
+	write(`
+keys:
+  - name: mobile-app
+    sha256: ` + auth.HashAPIKey("mobile-secret") + `
+    routes: [/v1/weather]
+    enabled: true
+`)
+	keys, err := auth.LoadAPIKeys(path)
+	require.NoError(t, err)
+	key, found := keys.Lookup("mobile-secret")
+	require.True(t, found)
+	assert.Equal(t, "mobile-app", key.Name)
+	_, found = keys.Lookup(auth.HashAPIKey("mobile-secret"))
+	assert.False(t, found, "the hash is not a key")
+
+	// invalid files leave the keys untouched
+	for _, content := range []string{
+		"keys: [",
+		"keys:\n  - name: broken\n    sha256: abc\n",
+		"keys:\n  - sha256: " + auth.HashAPIKey("other") + "\n",
+		"keys:\n  - name: a\n    sha256: " + auth.HashAPIKey("x") + "\n  - name: a\n    sha256: " + auth.HashAPIKey("y") + "\n",
+	} {
+		write(content)
+		assert.Error(t, keys.Load(path), content)
+		_, found = keys.Lookup("mobile-secret")
+		assert.True(t, found)
+	}
+
+	write("keys: []\n")
+	require.NoError(t, keys.Load(path))
+	_, found = keys.Lookup("mobile-secret")
+	assert.False(t, found)
+}
@@ -0,0 +1,27 @@
+package auth
+
+import "context"
+
+// Identity is the authenticated consumer of a request.
+type Identity struct {
+	// Name identifies the consumer, e.g. the name of its API key.
+	Name string
+	// Method is the method the consumer authenticated with, e.g. api-key.
+	Method string
+	// Scopes are the scopes granted to the consumer, if authenticated with a
+	// bearer JWT.
+	Scopes []string
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying id.
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the identity carried by ctx, if any.
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(*Identity)
+	return id, ok
+}
@@ -0,0 +1,300 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// maxJWKSSize bounds the size of the JWKS documents read.
+	maxJWKSSize = 1 << 20
+	// minJWKSRefetchInterval bounds how often unknown key IDs trigger a fetch
+	// of the JWKS, so that forged tokens cannot flood the identity provider.
+	minJWKSRefetchInterval = 30 * time.Second
+)
+
+// ErrUnknownKey is returned by a KeySet with no key matching a key ID.
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// KeySet provides the public keys verifying the signature of tokens.
+type KeySet interface {
+	// Key returns the key with the given ID, which is empty if the token does
+	// not name its key.
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// jwk is a JSON Web Key, as defined by RFC 7517.
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	// RSA keys
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC keys
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// jwks is a JSON Web Key Set.
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// parseJWKS returns the signature keys of the JWKS in b by ID. Keys of
+// unsupported types are ignored.
+func parseJWKS(b []byte) (map[string]crypto.PublicKey, error) {
+	var set jwks
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("parsing JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if errors.Is(err, errUnsupportedKey) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parsing JWK %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+var errUnsupportedKey = errors.New("unsupported key type")
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, errUnsupportedKey
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// StaticKeys is a KeySet of keys loaded once.
+type StaticKeys struct {
+	keys map[string]crypto.PublicKey
+}
+
+// LoadKeyFile returns the keys of the file at path, either a JWKS or PEM
+// encoded public keys. PEM encoded keys have no ID, and verify tokens
+// whatever key they name if the file holds a single key.
+func LoadKeyFile(path string) (*StaticKeys, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key file: %w", err)
+	}
+
+	block, rest := pem.Decode(b)
+	if block == nil {
+		keys, err := parseJWKS(b)
+		if err != nil {
+			return nil, err
+		}
+		return &StaticKeys{keys: keys}, nil
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for i := 0; block != nil; i++ {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing public key: %w", err)
+		}
+		keys[fmt.Sprint(i)] = key
+		block, rest = pem.Decode(rest)
+	}
+	if len(keys) == 1 {
+		return &StaticKeys{keys: map[string]crypto.PublicKey{"": keys["0"]}}, nil
+	}
+	return &StaticKeys{keys: keys}, nil
+}
+
+// Key returns the key with the given ID.
+func (s *StaticKeys) Key(_ context.Context, kid string) (crypto.PublicKey, error) {
+	if key, found := s.keys[kid]; found {
+		return key, nil
+	}
+	if key, found := s.keys[""]; found && len(s.keys) == 1 {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// RemoteJWKS is a KeySet fetched from a JWKS URL. The keys are cached and
+// fetched again every refresh interval, or when a token names an unknown key
+// so that rotated keys are picked up right away. Fetches run in the
+// background: cached keys are served while the keys are refreshed, and only
+// the callers needing a key not cached yet wait for the fetch. The cached keys
+// are kept if a fetch fails.
+type RemoteJWKS struct {
+	client  *http.Client
+	url     string
+	refresh time.Duration
+
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	// attemptedAt is the time of the last fetch, successful or not.
+	attemptedAt time.Time
+	// err is the error of the last fetch, if it failed.
+	err error
+	// fetching is closed once the fetch in progress, if any, completes.
+	fetching chan struct{}
+	now      func() time.Time
+
+	mu sync.Mutex
+}
+
+// NewRemoteJWKS creates a new RemoteJWKS fetching the keys from url with the
+// given http client if provided. The client should have a timeout, as
+// fetches are not bound to the requests needing the keys.
+func NewRemoteJWKS(httpClient *http.Client, url string, refresh time.Duration) *RemoteJWKS {
+	if httpClient == nil {
+		httpClient = &http.Client{}
+	}
+	return &RemoteJWKS{
+		client:  httpClient,
+		url:     url,
+		refresh: refresh,
+		now:     time.Now,
+	}
+}
+
+// Key returns the key with the given ID.
+func (r *RemoteJWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	r.mu.Lock()
+	now := r.now()
+	key, found := r.keys[kid]
+	stale := r.keys == nil || now.Sub(r.fetchedAt) >= r.refresh
+	if (stale || !found) && r.fetching == nil && now.Sub(r.attemptedAt) >= minJWKSRefetchInterval {
+		r.attemptedAt = now
+		r.fetching = make(chan struct{})
+		go r.refetch(now, r.fetching)
+	}
+	fetching := r.fetching
+	r.mu.Unlock()
+
+	if found {
+		return key, nil
+	}
+	if fetching != nil {
+		select {
+		case <-fetching:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if key, found := r.keys[kid]; found {
+		return key, nil
+	}
+	if r.keys == nil && r.err != nil {
+		return nil, r.err
+	}
+	return nil, ErrUnknownKey
+}
+
+// refetch fetches the keys, recording them as fetched at startedAt, and
+// closes done once they are updated.
+func (r *RemoteJWKS) refetch(startedAt time.Time, done chan struct{}) {
+	keys, err := r.fetch(context.Background())
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = err
+	if err == nil {
+		r.keys = keys
+		r.fetchedAt = startedAt
+	}
+	r.fetching = nil
+	close(done)
+}
+
+func (r *RemoteJWKS) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating JWKS request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching JWKS: unexpected status %s", resp.Status)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	if err != nil {
+		return nil, fmt.Errorf("reading JWKS: %w", err)
+	}
+	return parseJWKS(b)
+}
@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jwkOf returns the JWK of the public key of signer.
+func jwkOf(t *testing.T, kid string, signer crypto.Signer) jwk {
+	t.Helper()
+	enc := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+	switch key := signer.Public().(type) {
+	case *rsa.PublicKey:
+		return jwk{Kid: kid, Kty: "RSA", Use: "sig", N: enc(key.N), E: enc(big.NewInt(int64(key.E)))}
+	case *ecdsa.PublicKey:
+		return jwk{Kid: kid, Kty: "EC", Crv: key.Curve.Params().Name, X: enc(key.X), Y: enc(key.Y)}
+	}
+	t.Fatalf("unsupported key %T", signer)
+	return jwk{}
+}
+
+// jwksServer serves a JWKS which can be replaced, counting the fetches.
+type jwksServer struct {
+	*httptest.Server
+	fetches atomic.Int64
+
+	mu  sync.Mutex
+	set jwks
+}
+
+func newJWKSServer(t *testing.T, keys ...jwk) *jwksServer {
+	t.Helper()
+	s := &jwksServer{set: jwks{Keys: keys}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.set.Keys == nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(s.set)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// rotate replaces the served keys, or makes the server fail if none.
+func (s *jwksServer) rotate(keys ...jwk) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.set = jwks{Keys: keys}
+}
+
+func TestRemoteJWKS(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	key1, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	key2, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	srv := newJWKSServer(t, jwkOf(t, "key-1", key1))
+	now := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	r := NewRemoteJWKS(srv.Client(), srv.URL, time.Hour)
+	r.now = func() time.Time { return now }
+
+	got, err := r.Key(ctx, "key-1")
+	require.NoError(t, err)
+	assert.True(t, key1.PublicKey.Equal(got))
+
+	// known keys are served from the cache
+	_, err = r.Key(ctx, "key-1")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, srv.fetches.Load())
+
+	// unknown keys are fetched at most every minJWKSRefetchInterval
+	srv.rotate(jwkOf(t, "key-1", key1), jwkOf(t, "key-2", key2))
+	_, err = r.Key(ctx, "key-2")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	assert.EqualValues(t, 1, srv.fetches.Load())
+	now = now.Add(minJWKSRefetchInterval)
+	got, err = r.Key(ctx, "key-2")
+	require.NoError(t, err)
+	assert.True(t, key2.PublicKey.Equal(got))
+	assert.EqualValues(t, 2, srv.fetches.Load())
+
+	// the cached keys are kept when the JWKS cannot be fetched
+	srv.rotate()
+	now = now.Add(time.Hour)
+	_, err = r.Key(ctx, "key-1")
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return !r.isFetching() }, time.Second, time.Millisecond)
+	assert.EqualValues(t, 3, srv.fetches.Load())
+	_, err = r.Key(ctx, "key-1")
+	require.NoError(t, err)
+
+	// stale keys are served while the JWKS is fetched again, then replaced
+	srv.rotate(jwkOf(t, "key-2", key2))
+	now = now.Add(minJWKSRefetchInterval)
+	_, err = r.Key(ctx, "key-1")
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return !r.isFetching() }, time.Second, time.Millisecond)
+	_, err = r.Key(ctx, "key-1")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	assert.EqualValues(t, 4, srv.fetches.Load())
+}
+
+func TestRemoteJWKS_SlowFetch(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	set, err := json.Marshal(jwks{Keys: []jwk{jwkOf(t, "key-1", key)}})
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	var fetches atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) > 1 {
+			<-release
+		}
+		_, _ = w.Write(set)
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+
+	now := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	r := NewRemoteJWKS(srv.Client(), srv.URL, time.Hour)
+	r.now = func() time.Time { return now }
+	_, err = r.Key(ctx, "key-1")
+	require.NoError(t, err)
+
+	// cached keys are served while a refresh is blocked
+	now = now.Add(time.Hour)
+	_, err = r.Key(ctx, "key-1")
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return fetches.Load() == 2 }, time.Second, time.Millisecond)
+	_, err = r.Key(ctx, "key-1")
+	require.NoError(t, err)
+
+	// callers waiting for an unknown key give up with their context
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = r.Key(cancelled, "key-2")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.EqualValues(t, 2, fetches.Load())
+}
+
+// isFetching reports whether a fetch of the keys is in progress.
+func (r *RemoteJWKS) isFetching() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.fetching != nil
+}
+
+func TestRemoteJWKS_FetchError(t *testing.T) {
+	t.Parallel()
+	srv := newJWKSServer(t)
+	r := NewRemoteJWKS(srv.Client(), srv.URL, time.Hour)
+	_, err := r.Key(context.Background(), "key-1")
+	assert.ErrorContains(t, err, "unexpected status 503")
+}
+
+func TestLoadKeyFile(t *testing.T) {
+	t.Parallel()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	pemOf := func(signer crypto.Signer) string {
+		der, err := x509.MarshalPKIXPublicKey(signer.Public())
+		require.NoError(t, err)
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	}
+	jwksOf := func(keys ...jwk) string {
+		b, err := json.Marshal(jwks{Keys: keys})
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		kid     string
+		want    crypto.PublicKey
+		wantErr string
+	}{
+		{name: "JWKS", content: jwksOf(jwkOf(t, "rsa", rsaKey), jwkOf(t, "ec", ecKey)), kid: "ec", want: ecKey.Public()},
+		{name: "JWKS unknown key", content: jwksOf(jwkOf(t, "rsa", rsaKey)), kid: "ec", wantErr: ErrUnknownKey.Error()},
+		{name: "single PEM key verifies any key ID", content: pemOf(rsaKey), kid: "any", want: rsaKey.Public()},
+		{name: "PEM keys without key ID", content: pemOf(rsaKey) + pemOf(ecKey), kid: "", wantErr: ErrUnknownKey.Error()},
+		{name: "invalid JWKS", content: `{"keys": [{"kty": "EC", "crv": "P-256", "x": "AA", "y": "AA"}]}`, wantErr: "point not on curve"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), "keys")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+
+			keys, err := LoadKeyFile(path)
+			if err == nil {
+				var got crypto.PublicKey
+				got, err = keys.Key(context.Background(), tt.kid)
+				if err == nil {
+					assert.Equal(t, tt.want, got)
+				}
+			}
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
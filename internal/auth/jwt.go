@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	// MethodJWT is the method of identities authenticated by a bearer JWT.
+	MethodJWT = "jwt"
+
+	// jwtLeeway tolerates clock skew with the identity provider.
+	jwtLeeway = 30 * time.Second
+)
+
+// signingMethods are the asymmetric algorithms accepted for tokens. Symmetric
+// algorithms are rejected, so that public keys cannot be used as HMAC secrets.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// Claims are the claims of a token used by the service.
+type Claims struct {
+	jwt.RegisteredClaims
+	// Scope is the space separated list of scopes granted to the token, and
+	// Scp their list, as issued by some identity providers.
+	Scope string   `json:"scope,omitempty"`
+	Scp   []string `json:"scp,omitempty"`
+}
+
+// Scopes returns the scopes granted to the token.
+func (c *Claims) Scopes() []string {
+	return append(strings.Fields(c.Scope), c.Scp...)
+}
+
+// JWTValidator validates bearer JWTs issued by an identity provider.
+type JWTValidator struct {
+	keys   KeySet
+	parser *jwt.Parser
+}
+
+// NewJWTValidator creates a new JWTValidator accepting tokens signed by keys,
+// issued by issuer for audience.
+func NewJWTValidator(keys KeySet, issuer, audience string) *JWTValidator {
+	return &JWTValidator{
+		keys: keys,
+		parser: jwt.NewParser(
+			jwt.WithValidMethods(signingMethods),
+			jwt.WithIssuer(issuer),
+			jwt.WithAudience(audience),
+			jwt.WithLeeway(jwtLeeway),
+		),
+	}
+}
+
+// Validate returns the claims of token if it is validly signed, issued for
+// the audience by the issuer, not expired, and names its subject, which
+// identifies the consumer.
+func (v *JWTValidator) Validate(ctx context.Context, token string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("token has no expiry")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	return claims, nil
+}
+
+// AuthenticateJWT returns a gin middleware authenticating requests carrying a
+// bearer JWT validated by v, unless already authenticated. Invalid tokens and
+// tokens not granted scope are rejected by Required. Requests without a bearer
+// token are passed on, to be authenticated otherwise or rejected by Required.
+func AuthenticateJWT(v *JWTValidator, scope string, logger *zap.SugaredLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, found := bearerToken(c)
+		if !found || attempted(c) {
+			c.Next()
+			return
+		}
+
+		claims, err := v.Validate(c.Request.Context(), token)
+		if err != nil {
+			logFromContext(c, logger).Infow("Rejected bearer token", "error", err)
+			reject(c, http.StatusUnauthorized, "Invalid bearer token.", `Bearer error="invalid_token"`)
+			c.Next()
+			return
+		}
+
+		scopes := claims.Scopes()
+		authenticate(c, &Identity{Name: claims.Subject, Method: MethodJWT, Scopes: scopes}, logger)
+		if !hasScope(scopes, scope) {
+			reject(c, http.StatusForbidden, "Bearer token not granted the required scope.",
+				fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, scope))
+		}
+		c.Next()
+	}
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,270 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/cityhunteur/weather-service/internal/auth"
+)
+
+const (
+	testIssuer   = "https://idp.example.com/"
+	testAudience = "weather-service"
+)
+
+// newJWKSServer serves the JWKS of the given RSA keys by ID.
+func newJWKSServer(t *testing.T, keys map[string]*rsa.PrivateKey) *httptest.Server {
+	t.Helper()
+	enc := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for kid, key := range keys {
+		set.Keys = append(set.Keys, map[string]string{
+			"kid": kid,
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   enc(key.N),
+			"e":   enc(big.NewInt(int64(key.E))),
+		})
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string, claims *auth.Claims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	s, err := token.SignedString(key)
+	require.NoError(t, err)
+	return s
+}
+
+// validClaims returns the claims of a valid token granted scope.
+func validClaims(scope string) *auth.Claims {
+	now := time.Now()
+	return &auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "client-42",
+			Issuer:    testIssuer,
+			Audience:  jwt.ClaimStrings{testAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+		Scope: scope,
+	}
+}
+
+func TestJWTValidator_Validate(t *testing.T) {
+	t.Parallel()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	srv := newJWKSServer(t, map[string]*rsa.PrivateKey{"key-1": key})
+	v := auth.NewJWTValidator(auth.NewRemoteJWKS(srv.Client(), srv.URL, time.Hour), testIssuer, testAudience)
+
+	tests := []struct {
+		name    string
+		token   func() string
+		wantErr string
+	}{
+		{
+			name:  "valid",
+			token: func() string { return sign(t, jwt.SigningMethodRS256, key, "key-1", validClaims("weather:read")) },
+		},
+		{
+			name: "expired",
+			token: func() string {
+				c := validClaims("weather:read")
+				c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+				return sign(t, jwt.SigningMethodRS256, key, "key-1", c)
+			},
+			wantErr: "token is expired",
+		},
+		{
+			name: "no expiry",
+			token: func() string {
+				c := validClaims("weather:read")
+				c.ExpiresAt = nil
+				return sign(t, jwt.SigningMethodRS256, key, "key-1", c)
+			},
+			wantErr: "token has no expiry",
+		},
+		{
+			name: "no subject",
+			token: func() string {
+				c := validClaims("weather:read")
+				c.Subject = ""
+				return sign(t, jwt.SigningMethodRS256, key, "key-1", c)
+			},
+			wantErr: "token has no subject",
+		},
+		{
+			name: "wrong issuer",
+			token: func() string {
+				c := validClaims("weather:read")
+				c.Issuer = "https://evil.example.com/"
+				return sign(t, jwt.SigningMethodRS256, key, "key-1", c)
+			},
+			wantErr: "token has invalid issuer",
+		},
+		{
+			name: "wrong audience",
+			token: func() string {
+				c := validClaims("weather:read")
+				c.Audience = jwt.ClaimStrings{"other-service"}
+				return sign(t, jwt.SigningMethodRS256, key, "key-1", c)
+			},
+			wantErr: "token has invalid audience",
+		},
+		{
+			name:    "wrong key",
+			token:   func() string { return sign(t, jwt.SigningMethodRS256, other, "key-1", validClaims("weather:read")) },
+			wantErr: "signature is invalid",
+		},
+		{
+			name:    "unknown key",
+			token:   func() string { return sign(t, jwt.SigningMethodRS256, other, "key-2", validClaims("weather:read")) },
+			wantErr: auth.ErrUnknownKey.Error(),
+		},
+		{
+			name: "symmetric algorithm",
+			token: func() string {
+				return sign(t, jwt.SigningMethodHS256, []byte("secret"), "key-1", validClaims("weather:read"))
+			},
+			wantErr: "signing method HS256 is invalid",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			claims, err := v.Validate(context.Background(), tt.token())
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "client-42", claims.Subject)
+			assert.Equal(t, []string{"weather:read"}, claims.Scopes())
+		})
+	}
+}
+
+func TestAuthenticateJWT(t *testing.T) {
+	t.Parallel()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	srv := newJWKSServer(t, map[string]*rsa.PrivateKey{"key-1": key})
+	v := auth.NewJWTValidator(auth.NewRemoteJWKS(srv.Client(), srv.URL, time.Hour), testIssuer, testAudience)
+	keys, err := auth.NewAPIKeys([]*auth.APIKey{
+		{Name: "mobile-app", SHA256: auth.HashAPIKey("mobile-secret"), Routes: []string{"*"}, Enabled: true},
+	})
+	require.NoError(t, err)
+
+	readToken := sign(t, jwt.SigningMethodRS256, key, "key-1", validClaims("weather:read"))
+	adminClaims := validClaims("")
+	adminClaims.Scp = []string{"weather:read", "weather:admin"}
+	adminToken := sign(t, jwt.SigningMethodRS256, key, "key-1", adminClaims)
+
+	tests := []struct {
+		name           string
+		target         string
+		token          string
+		apiKey         string
+		wantStatusCode int
+		wantIdentity   *auth.Identity
+	}{
+		{name: "no credentials", target: "/v1/weather", wantStatusCode: http.StatusUnauthorized},
+		{name: "invalid token", target: "/v1/weather", token: "not-a-jwt", wantStatusCode: http.StatusUnauthorized},
+		{
+			name:           "read scope",
+			target:         "/v1/weather",
+			token:          readToken,
+			wantStatusCode: http.StatusOK,
+			wantIdentity:   &auth.Identity{Name: "client-42", Method: auth.MethodJWT, Scopes: []string{"weather:read"}},
+		},
+		{
+			name:           "API key",
+			target:         "/v1/weather",
+			apiKey:         "mobile-secret",
+			wantStatusCode: http.StatusOK,
+			wantIdentity:   &auth.Identity{Name: "mobile-app", Method: auth.MethodAPIKey},
+		},
+		{name: "admin without admin scope", target: "/admin/cache/stats", token: readToken, wantStatusCode: http.StatusForbidden},
+		{name: "admin with API key", target: "/admin/cache/stats", apiKey: "mobile-secret", wantStatusCode: http.StatusUnauthorized},
+		{
+			name:           "admin with admin scope",
+			target:         "/admin/cache/stats",
+			token:          adminToken,
+			wantStatusCode: http.StatusOK,
+			wantIdentity:   &auth.Identity{Name: "client-42", Method: auth.MethodJWT, Scopes: []string{"weather:read", "weather:admin"}},
+		},
+		{
+			name:           "admin with static token",
+			target:         "/admin/cache/stats",
+			token:          "s3cr3t",
+			wantStatusCode: http.StatusOK,
+			wantIdentity:   &auth.Identity{Name: "admin", Method: auth.MethodToken},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			logger := zaptest.NewLogger(t).Sugar()
+			var got *auth.Identity
+			ok := func(c *gin.Context) {
+				got, _ = auth.FromContext(c.Request.Context())
+				c.Status(http.StatusOK)
+			}
+
+			resp := httptest.NewRecorder()
+			_, router := gin.CreateTestContext(resp)
+			router.Group("/v1",
+				auth.AuthenticateAPIKey(keys, logger),
+				auth.AuthenticateJWT(v, "weather:read", logger),
+				auth.Required(),
+			).GET("/weather", ok)
+			router.Group("/admin",
+				auth.AuthenticateToken("s3cr3t", logger),
+				auth.AuthenticateJWT(v, "weather:admin", logger),
+				auth.Required(),
+			).GET("/cache/stats", ok)
+			req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, tt.target, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.apiKey != "" {
+				req.Header.Set(auth.APIKeyHeader, tt.apiKey)
+			}
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.wantStatusCode, resp.Code)
+			assert.Equal(t, tt.wantIdentity, got)
+			if tt.wantStatusCode == http.StatusUnauthorized && tt.token != "" {
+				assert.Contains(t, resp.Header().Get("WWW-Authenticate"), "invalid_token")
+			}
+		})
+	}
+}
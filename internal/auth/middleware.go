@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cityhunteur/weather-service/internal/logging"
+)
+
+// MethodToken is the method of identities authenticated by the static admin
+// token.
+const MethodToken = "token"
+
+// AuthenticateToken returns a gin middleware authenticating requests carrying the given
+// static bearer token, unless already authenticated, as the admin consumer.
+// Other requests are passed on, e.g. to be authenticated by JWT.
+func AuthenticateToken(token string, logger *zap.SugaredLogger) gin.HandlerFunc {
+	want := sha256.Sum256([]byte(token))
+	return func(c *gin.Context) {
+		got, found := bearerToken(c)
+		if !found || attempted(c) {
+			c.Next()
+			return
+		}
+		sum := sha256.Sum256([]byte(got))
+		if subtle.ConstantTimeCompare(sum[:], want[:]) == 1 {
+			authenticate(c, &Identity{Name: "admin", Method: MethodToken}, logger)
+		}
+		c.Next()
+	}
+}
+
+// failureKey is the gin context key of the failure of the authentication of a
+// request.
+const failureKey = "auth.failure"
+
+// failure is the response rejecting a request whose credentials are invalid
+// or not allowed.
+type failure struct {
+	status  int
+	message string
+	// challenge is the WWW-Authenticate header of the response, if any.
+	challenge string
+}
+
+// Required returns a gin middleware rejecting requests which were not
+// authenticated by the middlewares before it. The Authenticate* middlewares
+// each authenticate the requests carrying their kind of credentials and pass
+// on the others, so that they are chained in front of Required, e.g.
+//
+//	r.Use(AuthenticateAPIKey(keys, logger), AuthenticateJWT(v, scope, logger), Required())
+//
+// Requests with invalid or not allowed credentials are also passed on by the
+// Authenticate* middlewares, and rejected by Required, so that middlewares
+// between them, e.g. rate limiting, see every request.
+func Required() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if v, found := c.Get(failureKey); found {
+			f := v.(*failure)
+			if f.challenge != "" {
+				c.Header("WWW-Authenticate", f.challenge)
+			}
+			c.AbortWithStatusJSON(f.status, gin.H{"message": f.message})
+			return
+		}
+		if !authenticated(c) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Missing credentials."})
+			return
+		}
+		c.Next()
+	}
+}
+
+// authenticated reports whether the request of c carries an identity.
+func authenticated(c *gin.Context) bool {
+	_, ok := FromContext(c.Request.Context())
+	return ok
+}
+
+// attempted reports whether the request of c was authenticated, or rejected,
+// by a middleware before.
+func attempted(c *gin.Context) bool {
+	_, failed := c.Get(failureKey)
+	return failed || authenticated(c)
+}
+
+// reject records that the request of c is to be rejected by Required with
+// the given status and message, and WWW-Authenticate challenge if not empty.
+func reject(c *gin.Context, status int, message, challenge string) {
+	c.Set(failureKey, &failure{status: status, message: message, challenge: challenge})
+}
+
+// authenticate attaches id to the request context of c, and names the
+// consumer in its logger.
+func authenticate(c *gin.Context, id *Identity, logger *zap.SugaredLogger) {
+	ctx := NewContext(c.Request.Context(), id)
+	ctx = logging.NewContext(ctx, logging.FromContext(ctx, logger).With("consumer", id.Name))
+	c.Request = c.Request.WithContext(ctx)
+}
+
+// logFromContext returns the logger of the request of c.
+func logFromContext(c *gin.Context, logger *zap.SugaredLogger) *zap.SugaredLogger {
+	return logging.FromContext(c.Request.Context(), logger)
+}
+
+// bearerToken returns the bearer token of the Authorization header of the
+// request of c, if any.
+func bearerToken(c *gin.Context) (string, bool) {
+	token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	return token, found && token != ""
+}
@@ -0,0 +1,68 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/cityhunteur/weather-service/internal/auth"
+	"github.com/cityhunteur/weather-service/internal/logging"
+)
+
+func TestAuthenticateToken(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name           string
+		token          string
+		wantStatusCode int
+		wantConsumer   string
+	}{
+		{name: "missing token", wantStatusCode: http.StatusUnauthorized},
+		{name: "wrong token", token: "guess", wantStatusCode: http.StatusUnauthorized},
+		{name: "valid token", token: "s3cr3t", wantStatusCode: http.StatusOK, wantConsumer: "admin"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			core, logs := observer.New(zapcore.InfoLevel)
+			logger := zap.New(core).Sugar()
+
+			var got *auth.Identity
+			resp := httptest.NewRecorder()
+			_, router := gin.CreateTestContext(resp)
+			router.Use(logging.Middleware(logger))
+			router.GET("/admin/cache/stats", auth.AuthenticateToken("s3cr3t", logger), auth.Required(), func(c *gin.Context) {
+				got, _ = auth.FromContext(c.Request.Context())
+				c.Status(http.StatusOK)
+			})
+			req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/admin/cache/stats", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.wantStatusCode, resp.Code)
+			if tt.wantStatusCode == http.StatusOK {
+				assert.Equal(t, &auth.Identity{Name: tt.wantConsumer, Method: auth.MethodToken}, got)
+			}
+
+			// the access log names the consumer once authenticated
+			access := logs.FilterMessage("Handled request").All()
+			require.Len(t, access, 1)
+			if tt.wantConsumer != "" {
+				assert.Equal(t, tt.wantConsumer, access[0].ContextMap()["consumer"])
+			} else {
+				assert.NotContains(t, access[0].ContextMap(), "consumer")
+			}
+		})
+	}
+}
@@ -1,50 +1,463 @@
 package cache
 
 import (
+	"container/list"
+	"context"
+	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	v1 "github.com/cityhunteur/weather-service/api/v1"
 )
 
+// Defaults of the stores created without WithTTL or WithCapacity, which are
+// also the defaults of the configuration of the service.
 const (
-	defaultExpiry   time.Duration = 5 * time.Hour
-	defaultCapacity               = 100
+	DefaultTTL      = 5 * time.Hour
+	DefaultCapacity = 1000
 )
 
-// Store is an in-memory cache backed by a map.
-type Store struct {
-	data map[string]*v1.Forecast
+const (
+	defaultLoadTimeout = 10 * time.Second
+
+	// entryOverhead is the estimated size of an entry, excluding its value.
+	entryOverhead = 128
+)
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	size      int64
+	storedAt  time.Time
+	expiresAt time.Time
+}
+
+// Store is an in-memory cache backed by a map. It holds at most a fixed
+// number of entries, evicting the least recently used entry when full.
+type Store[K comparable, V any] struct {
+	data map[K]*list.Element
+	// lru orders entries from most to least recently used.
+	lru *list.List
+	// loads holds the loads in progress by key.
+	loads map[K]*load[V]
+
+	options
+	// sizeFunc estimates the number of bytes held by the key and value of an
+	// entry, if set.
+	sizeFunc func(k K, v V) int64
+	bytes    int64
+	stats    Stats
+	now      func() time.Time
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu sync.Mutex
+}
+
+// ForecastStore is a Store of forecasts by key.
+type ForecastStore = Store[string, *v1.Forecast]
+
+// load is a call to a LoadFunc shared by concurrent GetOrLoad calls.
+type load[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// LoadFunc loads the value of a key missing from a cache.
+type LoadFunc[V any] func(ctx context.Context) (V, error)
+
+// NewStore creates a new Store, whose entries are all assumed to have the
+// same size. It panics if the capacity is not positive, as the store would
+// evict every entry.
+func NewStore[K comparable, V any](opts ...Option) *Store[K, V] {
+	return NewSizedStore[K, V](nil, opts...)
+}
+
+// NewSizedStore creates a new Store estimating the number of bytes held by the
+// key and value of an entry with size, to bound the store with WithMaxBytes.
+// It panics if the capacity is not positive, as the store would evict every
+// entry.
+func NewSizedStore[K comparable, V any](size func(k K, v V) int64, opts ...Option) *Store[K, V] {
+	o := newOptions(opts)
+	if o.capacity <= 0 {
+		panic(fmt.Sprintf("cache: non-positive capacity %d", o.capacity))
+	}
+	c := &Store[K, V]{
+		data:     make(map[K]*list.Element),
+		lru:      list.New(),
+		loads:    make(map[K]*load[V]),
+		options:  o,
+		sizeFunc: size,
+		now:      time.Now,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
 
-	mu sync.RWMutex
+	if c.janitorInterval > 0 {
+		go c.runJanitor()
+	} else {
+		close(c.done)
+	}
+	return c
 }
 
-// NewStore creates a new Store.
-func NewStore() *Store {
-	return &Store{
-		data: make(map[string]*v1.Forecast, defaultCapacity),
+// Set adds the given value v to the cache using the specified k. The entry
+// expires after ttl, or after the TTL of the store if ttl is not positive.
+func (c *Store[K, V]) Set(k K, v V, ttl time.Duration) {
+	size := c.sizeOf(k, v)
+	now := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ttl <= 0 {
+		ttl = c.ttl
 	}
+	c.insert(&entry[K, V]{
+		key:       k,
+		value:     v,
+		size:      size,
+		storedAt:  now,
+		expiresAt: now.Add(ttl),
+	})
 }
 
-// Set adds the given value v to the cache using the specified k.
-func (c *Store) Set(k string, v *v1.Forecast) {
+// SetTTL changes the TTL of the entries stored from now on without a TTL of
+// their own.
+func (c *Store[K, V]) SetTTL(ttl time.Duration) {
 	c.mu.Lock()
-	c.data[k] = v
-	c.mu.Unlock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+}
+
+// SetGrace changes the grace window during which expired entries are still
+// served.
+func (c *Store[K, V]) SetGrace(grace time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.grace = grace
 }
 
 // Get return the value with the specified k if it exists and has not expired.
-func (c *Store) Get(k string) (*v1.Forecast, bool) {
-	c.mu.RLock()
-	entry, found := c.data[k]
+func (c *Store[K, V]) Get(k K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	el, found := c.data[k]
+	if !found {
+		c.stats.Misses++
+		return zero, false
+	}
+	e := el.Value.(*entry[K, V])
+	if !c.now().Before(e.expiresAt) {
+		c.stats.Misses++
+		return zero, false
+	}
+	c.stats.Hits++
+	c.lru.MoveToFront(el)
+	return e.value, true
+}
+
+// GetStale returns the value with the specified k and the time it was stored
+// if it exists, even if it has expired within the grace window of the store.
+func (c *Store[K, V]) GetStale(k K) (V, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	el, found := c.data[k]
+	if !found {
+		return zero, time.Time{}, false
+	}
+	e := el.Value.(*entry[K, V])
+	if !c.now().Before(e.expiresAt.Add(c.grace)) {
+		return zero, time.Time{}, false
+	}
+	c.lru.MoveToFront(el)
+	return e.value, e.storedAt, true
+}
+
+// Lookup returns the value with the specified k and the time it was stored if
+// it exists, even if it has expired within the grace window of the store, and
+// whether it is still fresh. It costs a single lookup where Get followed by
+// GetStale costs two.
+func (c *Store[K, V]) Lookup(k K) (V, time.Time, bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	el, found := c.data[k]
+	if !found {
+		c.stats.Misses++
+		return zero, time.Time{}, false, false
+	}
+	e := el.Value.(*entry[K, V])
+	now := c.now()
+	fresh := now.Before(e.expiresAt)
+	if !fresh {
+		c.stats.Misses++
+		if !now.Before(e.expiresAt.Add(c.grace)) {
+			return zero, time.Time{}, false, false
+		}
+	} else {
+		c.stats.Hits++
+	}
+	c.lru.MoveToFront(el)
+	return e.value, e.storedAt, fresh, true
+}
+
+// GetOrLoad returns the value with the specified k if it exists and has not
+// expired. Otherwise, it stores and returns the value loaded by fn, which is
+// called once for all concurrent callers with the same k. fn is given the
+// values of ctx, but neither its deadline nor its cancellation, so that the
+// first caller giving up does not fail the load of the others; it is bounded
+// by the load timeout of the store instead. Errors returned by fn are not
+// cached, and a panic in fn is returned as an error.
+func (c *Store[K, V]) GetOrLoad(ctx context.Context, k K, fn LoadFunc[V]) (V, error) {
+	if v, found := c.Get(k); found {
+		return v, nil
+	}
+
+	c.mu.Lock()
+	l, loading := c.loads[k]
+	if !loading {
+		l = &load[V]{done: make(chan struct{})}
+		c.loads[k] = l
+	}
+	c.mu.Unlock()
+
+	if !loading {
+		go c.load(detached{ctx}, k, l, fn)
+	}
+
+	select {
+	case <-l.done:
+		return l.value, l.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// load calls fn to load the value of k shared by l, storing it on success.
+func (c *Store[K, V]) load(ctx context.Context, k K, l *load[V], fn LoadFunc[V]) {
+	defer func() {
+		if r := recover(); r != nil {
+			l.err = fmt.Errorf("loading cache entry: panic: %v", r)
+		}
+		c.mu.Lock()
+		delete(c.loads, k)
+		c.mu.Unlock()
+		close(l.done)
+	}()
+
+	if c.loadTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.loadTimeout)
+		defer cancel()
+	}
+	l.value, l.err = fn(ctx)
+	if l.err == nil {
+		c.Set(k, l.value, 0)
+	}
+}
+
+// detached is a context carrying the values of its parent, but neither its
+// deadline nor its cancellation.
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
+
+// Len returns the number of entries in the store, including expired entries
+// not yet purged.
+func (c *Store[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Entries returns the entries of the store, from most to least recently
+// used, without their values.
+func (c *Store[K, V]) Entries(_ context.Context) ([]Entry[K, V], error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries := make([]Entry[K, V], 0, c.lru.Len())
+	for el := c.lru.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*entry[K, V])
+		entries = append(entries, Entry[K, V]{
+			Key:       e.key,
+			StoredAt:  e.storedAt,
+			ExpiresAt: e.expiresAt,
+		})
+	}
+	return entries, nil
+}
+
+// Peek returns the entry with the specified k, even if it has expired,
+// without affecting its eviction order. It returns nil if no entry exists.
+func (c *Store[K, V]) Peek(_ context.Context, k K) (*Entry[K, V], error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, found := c.data[k]
 	if !found {
-		c.mu.RUnlock()
-		return nil, false
+		return nil, nil
+	}
+	e := el.Value.(*entry[K, V])
+	return &Entry[K, V]{
+		Key:       e.key,
+		Value:     e.value,
+		StoredAt:  e.storedAt,
+		ExpiresAt: e.expiresAt,
+	}, nil
+}
+
+// Delete removes the entry with the specified k and reports whether it
+// existed.
+func (c *Store[K, V]) Delete(_ context.Context, k K) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, found := c.data[k]
+	if found {
+		c.removeElement(el)
+	}
+	return found, nil
+}
+
+// Flush removes all entries and returns how many were removed.
+func (c *Store[K, V]) Flush(_ context.Context) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := c.lru.Len()
+	c.data = make(map[K]*list.Element)
+	c.lru.Init()
+	c.bytes = 0
+	return n, nil
+}
+
+// Purge removes the entries whose key starts with prefix and returns how many
+// were removed. Keys which are not strings never match.
+func (c *Store[K, V]) Purge(_ context.Context, prefix string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	purged := 0
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		k, ok := any(el.Value.(*entry[K, V]).key).(string)
+		if ok && strings.HasPrefix(k, prefix) {
+			c.removeElement(el)
+			purged++
+		}
+		el = next
+	}
+	return purged, nil
+}
+
+// Stats returns the counters of the store.
+func (c *Store[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	stats.Bytes = c.bytes
+	return stats
+}
+
+// Close stops the janitor, if any. It is safe to call Close more than once.
+func (c *Store[K, V]) Close() {
+	c.closeOnce.Do(func() { close(c.stop) })
+	<-c.done
+}
+
+func (c *Store[K, V]) runJanitor() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.janitorInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.purgeExpired()
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// purgeExpired removes all entries expired beyond the grace window from the
+// store.
+func (c *Store[K, V]) purgeExpired() {
+	now := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for el := c.lru.Back(); el != nil; {
+		prev := el.Prev()
+		if !now.Before(el.Value.(*entry[K, V]).expiresAt.Add(c.grace)) {
+			c.removeElement(el)
+			c.stats.Expirations++
+		}
+		el = prev
+	}
+}
+
+// insert adds e as the most recently used entry of the store, evicting the
+// least recently used entries beyond the bounds of the store. It must be
+// called with mu held.
+func (c *Store[K, V]) insert(e *entry[K, V]) {
+	if el, found := c.data[e.key]; found {
+		c.removeElement(el)
+	}
+	c.data[e.key] = c.lru.PushFront(e)
+	c.bytes += e.size
+
+	for c.lru.Len() > 0 && (c.lru.Len() > c.capacity || (c.maxBytes > 0 && c.bytes > c.maxBytes)) {
+		c.removeElement(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+// removeElement removes el from the store. It must be called with mu held.
+func (c *Store[K, V]) removeElement(el *list.Element) {
+	e := c.lru.Remove(el).(*entry[K, V])
+	delete(c.data, e.key)
+	c.bytes -= e.size
+}
+
+// sizeOf returns the estimated number of bytes held by an entry.
+func (c *Store[K, V]) sizeOf(k K, v V) int64 {
+	if c.sizeFunc == nil {
+		return entryOverhead
+	}
+	return entryOverhead + c.sizeFunc(k, v)
+}
+
+// ForecastSize estimates the number of bytes held by a forecast and its key,
+// for use with NewSizedStore.
+func ForecastSize(k string, v *v1.Forecast) int64 {
+	const detailOverhead = 64
+	size := int64(len(k))
+	if v == nil {
+		return size
 	}
-	if time.Time(entry.Detail[0].StartTime).UTC().Sub(time.Now().UTC()) > defaultExpiry {
-		c.mu.RUnlock()
-		return nil, false
+	size += int64(len(v.Name))
+	for _, d := range v.Detail {
+		size += int64(detailOverhead + len(d.Description))
 	}
-	c.mu.RUnlock()
-	return entry, true
+	return size
 }
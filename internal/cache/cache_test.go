@@ -0,0 +1,423 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "github.com/cityhunteur/weather-service/api/v1"
+)
+
+// fakeClock is a manually advanced clock.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.t }
+
+func (c *fakeClock) Add(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestStore(opts ...Option) (*ForecastStore, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2023, 6, 29, 21, 0, 0, 0, time.UTC)}
+	c := NewStore[string, *v1.Forecast](opts...)
+	c.now = clock.Now
+	return c, clock
+}
+
+func TestStore_Get(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		elapsed time.Duration
+		want    bool
+	}{
+		{
+			name:    "fresh with store ttl",
+			elapsed: time.Hour,
+			want:    true,
+		},
+		{
+			name:    "expired with store ttl",
+			elapsed: 2 * time.Hour,
+			want:    false,
+		},
+		{
+			name:    "fresh with entry ttl",
+			ttl:     3 * time.Hour,
+			elapsed: 2 * time.Hour,
+			want:    true,
+		},
+		{
+			name:    "expired with entry ttl",
+			ttl:     time.Minute,
+			elapsed: time.Minute,
+			want:    false,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c, clock := newTestStore(WithTTL(2 * time.Hour))
+			// entries without any detail must not break freshness checks
+			want := &v1.Forecast{Name: "New York"}
+			c.Set("new york", want, tt.ttl)
+			clock.Add(tt.elapsed)
+
+			got, found := c.Get("new york")
+			assert.Equal(t, tt.want, found)
+			if tt.want {
+				assert.Same(t, want, got)
+			} else {
+				assert.Nil(t, got)
+			}
+		})
+	}
+}
+
+func TestStore_GetStale(t *testing.T) {
+	t.Parallel()
+	c, clock := newTestStore(WithTTL(time.Hour), WithGrace(2*time.Hour))
+	storedAt := clock.Now()
+	want := &v1.Forecast{Name: "New York"}
+	c.Set("new york", want, 0)
+	clock.Add(2 * time.Hour)
+
+	_, found := c.Get("new york")
+	assert.False(t, found)
+
+	got, gotStoredAt, found := c.GetStale("new york")
+	assert.True(t, found)
+	assert.Same(t, want, got)
+	assert.Equal(t, storedAt, gotStoredAt)
+
+	_, _, found = c.GetStale("chicago")
+	assert.False(t, found)
+}
+
+func TestStore_Lookup(t *testing.T) {
+	t.Parallel()
+	c, clock := newTestStore(WithTTL(time.Hour), WithGrace(30*time.Minute))
+	storedAt := clock.Now()
+	want := &v1.Forecast{Name: "New York"}
+	c.Set("new york", want, 0)
+
+	got, gotStoredAt, fresh, found := c.Lookup("new york")
+	assert.True(t, found)
+	assert.True(t, fresh)
+	assert.Same(t, want, got)
+	assert.Equal(t, storedAt, gotStoredAt)
+
+	clock.Add(80 * time.Minute)
+	got, _, fresh, found = c.Lookup("new york")
+	assert.True(t, found)
+	assert.False(t, fresh)
+	assert.Same(t, want, got)
+
+	clock.Add(10 * time.Minute)
+	_, _, _, found = c.Lookup("new york")
+	assert.False(t, found)
+	_, _, _, found = c.Lookup("chicago")
+	assert.False(t, found)
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(3), stats.Misses)
+}
+
+func TestStore_Grace(t *testing.T) {
+	t.Parallel()
+	c, clock := newTestStore(WithTTL(time.Hour), WithGrace(30*time.Minute))
+	c.Set("new york", &v1.Forecast{Name: "New York"}, 0)
+
+	clock.Add(80 * time.Minute)
+	c.purgeExpired()
+	_, found := c.Get("new york")
+	assert.False(t, found)
+	_, _, found = c.GetStale("new york")
+	assert.True(t, found)
+
+	clock.Add(10 * time.Minute)
+	_, _, found = c.GetStale("new york")
+	assert.False(t, found)
+	c.purgeExpired()
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestStore_SetTTL(t *testing.T) {
+	t.Parallel()
+	c, clock := newTestStore(WithTTL(time.Hour))
+	c.Set("new york", &v1.Forecast{Name: "New York"}, 0)
+	c.SetTTL(10 * time.Minute)
+	c.Set("chicago", &v1.Forecast{Name: "Chicago"}, 0)
+
+	// entries stored before the change keep their TTL
+	clock.Add(10 * time.Minute)
+	_, found := c.Get("new york")
+	assert.True(t, found)
+	_, found = c.Get("chicago")
+	assert.False(t, found)
+}
+
+func TestStore_SetGrace(t *testing.T) {
+	t.Parallel()
+	c, clock := newTestStore(WithTTL(time.Hour), WithGrace(30*time.Minute))
+	c.Set("new york", &v1.Forecast{Name: "New York"}, 0)
+	c.SetGrace(10 * time.Minute)
+
+	// the grace window applies to the entries already stored
+	clock.Add(70 * time.Minute)
+	_, _, found := c.GetStale("new york")
+	assert.False(t, found)
+}
+
+func TestStore_Eviction(t *testing.T) {
+	t.Parallel()
+	c, _ := newTestStore(WithCapacity(2))
+	c.Set("new york", &v1.Forecast{Name: "New York"}, 0)
+	c.Set("chicago", &v1.Forecast{Name: "Chicago"}, 0)
+
+	// touch new york so that chicago becomes the least recently used
+	_, found := c.Get("new york")
+	assert.True(t, found)
+	c.Set("los angeles", &v1.Forecast{Name: "Los Angeles"}, 0)
+
+	assert.Equal(t, 2, c.Len())
+	_, found = c.Get("chicago")
+	assert.False(t, found)
+	_, found = c.Get("new york")
+	assert.True(t, found)
+	_, found = c.Get("los angeles")
+	assert.True(t, found)
+}
+
+func TestNewStore_Capacity(t *testing.T) {
+	t.Parallel()
+	assert.Panics(t, func() { NewStore[string, *v1.Forecast](WithCapacity(0)) })
+	assert.Panics(t, func() { NewStore[string, *v1.Forecast](WithCapacity(-1)) })
+}
+
+func TestStore_MaxBytes(t *testing.T) {
+	t.Parallel()
+	forecast := &v1.Forecast{
+		Name: "New York",
+		Detail: []*v1.Detail{
+			{Description: "Haze. Partly sunny, with a high near 85. Southwest wind around 6 mph."},
+		},
+	}
+	size := entryOverhead + ForecastSize("new york", forecast)
+	c := NewSizedStore(ForecastSize, WithMaxBytes(2*size))
+	c.Set("new york", forecast, 0)
+	c.Set("new york", forecast, 0)
+	c.Set("new york 2", forecast, 0)
+	c.Set("new york 3", forecast, 0)
+
+	assert.Equal(t, 1, c.Len())
+	_, found := c.Get("new york 3")
+	assert.True(t, found)
+}
+
+func TestStore_PurgeExpired(t *testing.T) {
+	t.Parallel()
+	c, clock := newTestStore(WithTTL(time.Hour))
+	c.Set("new york", &v1.Forecast{Name: "New York"}, 0)
+	c.Set("chicago", &v1.Forecast{Name: "Chicago"}, 3*time.Hour)
+	clock.Add(2 * time.Hour)
+
+	c.purgeExpired()
+
+	assert.Equal(t, 1, c.Len())
+	_, _, found := c.GetStale("new york")
+	assert.False(t, found)
+	_, found = c.Get("chicago")
+	assert.True(t, found)
+}
+
+func TestStore_Close(t *testing.T) {
+	t.Parallel()
+	c := NewStore[string, *v1.Forecast](WithJanitor(time.Millisecond))
+	c.Set("new york", &v1.Forecast{Name: "New York"}, time.Nanosecond)
+
+	assert.Eventually(t, func() bool { return c.Len() == 0 }, time.Second, time.Millisecond)
+	c.Close()
+	c.Close()
+}
+
+func TestStore_Admin(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	c, clock := newTestStore(WithTTL(time.Hour), WithCapacity(2))
+	storedAt := clock.Now()
+	c.Set("OKX/33,35", &v1.Forecast{Name: "New York"}, 0)
+	c.Set("LOX/154,44", &v1.Forecast{Name: "Los Angeles"}, 0)
+	c.Set("LOT/76,73", &v1.Forecast{Name: "Chicago"}, 0)
+	c.Get("LOT/76,73")
+	c.Get("OKX/33,35")
+
+	entries, err := c.Entries(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []ForecastEntry{
+		{Key: "LOT/76,73", StoredAt: storedAt, ExpiresAt: storedAt.Add(time.Hour)},
+		{Key: "LOX/154,44", StoredAt: storedAt, ExpiresAt: storedAt.Add(time.Hour)},
+	}, entries)
+
+	e, err := c.Peek(ctx, "LOX/154,44")
+	assert.NoError(t, err)
+	assert.Equal(t, "Los Angeles", e.Value.Name)
+	e, err = c.Peek(ctx, "OKX/33,35")
+	assert.NoError(t, err)
+	assert.Nil(t, e)
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, uint64(1), stats.Evictions)
+	assert.Equal(t, 2, stats.Entries)
+	assert.Positive(t, stats.Bytes)
+
+	deleted, err := c.Delete(ctx, "LOT/76,73")
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	deleted, err = c.Delete(ctx, "LOT/76,73")
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+
+	c.Set("LOT/76,73", &v1.Forecast{Name: "Chicago"}, 0)
+	purged, err := c.Purge(ctx, "LOT/")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	assert.Equal(t, uint64(1), c.Stats().Evictions)
+
+	n, err := c.Flush(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Zero(t, c.Stats().Bytes)
+}
+
+func TestStore_GetOrLoad(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	c := NewStore[string, int](WithTTL(time.Hour))
+
+	// concurrent callers share a single load
+	var loads atomic.Int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := c.GetOrLoad(ctx, "answer", func(ctx context.Context) (int, error) {
+				loads.Add(1)
+				<-release
+				return 42, nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, 42, v)
+		}()
+	}
+	assert.Eventually(t, func() bool { return loads.Load() == 1 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), loads.Load())
+	v, found := c.Get("answer")
+	assert.True(t, found)
+	assert.Equal(t, 42, v)
+
+	// errors are not cached
+	_, err := c.GetOrLoad(ctx, "question", func(ctx context.Context) (int, error) {
+		return 0, errors.New("unknown")
+	})
+	assert.Error(t, err)
+	_, found = c.Get("question")
+	assert.False(t, found)
+
+	// callers stop waiting once their context is done
+	blocked := make(chan struct{})
+	defer close(blocked)
+	go func() {
+		_, _ = c.GetOrLoad(ctx, "slow", func(ctx context.Context) (int, error) {
+			<-blocked
+			return 1, nil
+		})
+	}()
+	assert.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.loads) == 1
+	}, time.Second, time.Millisecond)
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = c.GetOrLoad(cancelled, "slow", func(ctx context.Context) (int, error) {
+		t.Error("unexpected load")
+		return 0, nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestStore_GetOrLoad_Detached(t *testing.T) {
+	t.Parallel()
+	c := NewStore[string, int](WithTTL(time.Hour), WithLoadTimeout(time.Second))
+
+	// the first caller giving up does not fail the load of the others
+	first, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	loaded := make(chan error, 1)
+	go func() {
+		_, err := c.GetOrLoad(first, "answer", func(ctx context.Context) (int, error) {
+			_, hasDeadline := ctx.Deadline()
+			assert.True(t, hasDeadline)
+			<-release
+			return 42, ctx.Err()
+		})
+		loaded <- err
+	}()
+	assert.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.loads) == 1
+	}, time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-loaded, context.Canceled)
+
+	waiter := make(chan int, 1)
+	go func() {
+		v, err := c.GetOrLoad(context.Background(), "answer", func(ctx context.Context) (int, error) {
+			t.Error("unexpected load")
+			return 0, nil
+		})
+		assert.NoError(t, err)
+		waiter <- v
+	}()
+	close(release)
+	assert.Equal(t, 42, <-waiter)
+
+	// a panicking load fails its callers, and is not left in progress
+	_, err := c.GetOrLoad(context.Background(), "question", func(ctx context.Context) (int, error) {
+		panic("boom")
+	})
+	assert.ErrorContains(t, err, "panic: boom")
+	v, err := c.GetOrLoad(context.Background(), "question", func(ctx context.Context) (int, error) {
+		return 7, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 7, v)
+}
+
+func TestStore_GetOrLoad_NoTimeout(t *testing.T) {
+	t.Parallel()
+	c := NewStore[string, int](WithLoadTimeout(0))
+	v, err := c.GetOrLoad(context.Background(), "answer", func(ctx context.Context) (int, error) {
+		_, hasDeadline := ctx.Deadline()
+		assert.False(t, hasDeadline)
+		return 42, ctx.Err()
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 42, v)
+}
@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"time"
+
+	v1 "github.com/cityhunteur/weather-service/api/v1"
+)
+
+// Entry describes an entry of a cache for administration purposes.
+type Entry[K comparable, V any] struct {
+	Key K
+	// Value is only set when a single entry is requested.
+	Value     V
+	StoredAt  time.Time
+	ExpiresAt time.Time
+}
+
+// ForecastEntry is an entry of a forecast cache.
+type ForecastEntry = Entry[string, *v1.Forecast]
+
+// Stats holds the counters of a cache.
+type Stats struct {
+	// Hits and Misses count the lookups of fresh entries.
+	Hits   uint64
+	Misses uint64
+	// Evictions counts the entries removed to stay within the bounds of the
+	// cache, and Expirations the expired entries purged. Entries removed by
+	// operators, with Delete, Purge or Flush, are not counted.
+	Evictions   uint64
+	Expirations uint64
+	// Entries is the number of entries held, and Bytes their estimated size
+	// if known.
+	Entries int
+	Bytes   int64
+}
@@ -0,0 +1,86 @@
+package cache
+
+import "time"
+
+type options struct {
+	ttl             time.Duration
+	grace           time.Duration
+	capacity        int
+	maxBytes        int64
+	janitorInterval time.Duration
+	prefix          string
+	loadTimeout     time.Duration
+}
+
+// Option configures a cache. Options that do not apply to a given
+// implementation are ignored.
+type Option func(o *options)
+
+// WithTTL sets the duration for which entries are fresh, unless a different
+// duration is given when the entry is stored.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// WithGrace keeps expired entries for the given duration, during which they
+// are only returned by GetStale.
+func WithGrace(grace time.Duration) Option {
+	return func(o *options) {
+		o.grace = grace
+	}
+}
+
+// WithCapacity sets the maximum number of entries held by the store, which
+// must be positive.
+func WithCapacity(n int) Option {
+	return func(o *options) {
+		o.capacity = n
+	}
+}
+
+// WithMaxBytes bounds the estimated memory used by the entries of the store,
+// sized by the function given to NewSizedStore. A value of zero means no
+// bound.
+func WithMaxBytes(n int64) Option {
+	return func(o *options) {
+		o.maxBytes = n
+	}
+}
+
+// WithLoadTimeout bounds the duration of the loads of GetOrLoad. A value of
+// zero or less means no bound.
+func WithLoadTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.loadTimeout = d
+	}
+}
+
+// WithJanitor starts a background goroutine purging expired entries at the
+// given interval. It is stopped by Close.
+func WithJanitor(interval time.Duration) Option {
+	return func(o *options) {
+		o.janitorInterval = interval
+	}
+}
+
+// WithPrefix sets the prefix prepended to the keys of a shared cache, so that
+// several services or environments can share the same backend.
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		ttl:         DefaultTTL,
+		capacity:    DefaultCapacity,
+		loadTimeout: defaultLoadTimeout,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,359 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	v1 "github.com/cityhunteur/weather-service/api/v1"
+)
+
+const (
+	// redisScanCount is the number of keys requested per SCAN iteration.
+	redisScanCount = 100
+	// redisStatsTimeout bounds the time spent counting entries for stats.
+	redisStatsTimeout = time.Second
+	// redisStatsInterval is how long the count of entries is reused for stats
+	// before scanning Redis again.
+	redisStatsInterval = 30 * time.Second
+	// redisOpTimeout bounds the time spent getting or setting an entry, so
+	// that a slow Redis does not hold up requests past their deadline.
+	redisOpTimeout = 500 * time.Millisecond
+)
+
+// redisEntry is the JSON representation of an entry stored in Redis.
+type redisEntry struct {
+	Value     *v1.Forecast `json:"value"`
+	StoredAt  time.Time    `json:"storedAt"`
+	ExpiresAt time.Time    `json:"expiresAt"`
+}
+
+// RedisStore is a cache backed by Redis, which can be shared by several
+// replicas of the service. Entries are kept by Redis for their TTL plus the
+// grace window. Errors talking to Redis are logged and treated as misses.
+type RedisStore struct {
+	client redis.UniversalClient
+	logger *zap.SugaredLogger
+
+	options
+	// defaultTTL is the TTL of the store, which can be changed by SetTTL.
+	defaultTTL atomic.Int64
+	// defaultGrace is the grace window of the store, which can be changed by
+	// SetGrace.
+	defaultGrace atomic.Int64
+	hits         atomic.Uint64
+	misses       atomic.Uint64
+	// opTimeout bounds the time spent getting or setting an entry.
+	opTimeout time.Duration
+	now       func() time.Time
+
+	// countMu guards the count of entries last reported by Stats.
+	countMu   sync.Mutex
+	count     int
+	countedAt time.Time
+	counting  bool
+}
+
+// NewRedisStore creates a new RedisStore using the given client. The client
+// is responsible for connection pooling and is not closed by the store. It
+// should have ContextTimeoutEnabled set, for the store to bound the time spent
+// on each operation.
+func NewRedisStore(client redis.UniversalClient, logger *zap.SugaredLogger, opts ...Option) *RedisStore {
+	c := &RedisStore{
+		client:    client,
+		logger:    logger,
+		options:   newOptions(opts),
+		opTimeout: redisOpTimeout,
+		now:       time.Now,
+	}
+	c.defaultTTL.Store(int64(c.ttl))
+	c.defaultGrace.Store(int64(c.grace))
+	return c
+}
+
+// Set adds the given value v to the cache using the specified k. The entry
+// expires after ttl, or after the TTL of the store if ttl is not positive.
+func (c *RedisStore) Set(k string, v *v1.Forecast, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = time.Duration(c.defaultTTL.Load())
+	}
+	now := c.now()
+	b, err := json.Marshal(&redisEntry{
+		Value:     v,
+		StoredAt:  now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		c.logger.Errorw("Failed to encode cache entry", "error", err, "key", k)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.opTimeout)
+	defer cancel()
+	err = c.client.Set(ctx, c.prefix+k, b, ttl+time.Duration(c.defaultGrace.Load())).Err()
+	if err != nil {
+		c.logger.Warnw("Failed to store cache entry in redis", "error", err, "key", k)
+	}
+}
+
+// Get return the value with the specified k if it exists and has not expired.
+func (c *RedisStore) Get(k string) (*v1.Forecast, bool) {
+	e, found := c.get(k)
+	if !found || !c.now().Before(e.ExpiresAt) {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.hits.Add(1)
+	return e.Value, true
+}
+
+// GetStale returns the value with the specified k and the time it was stored
+// if it exists, even if it has expired within the grace window of the store.
+func (c *RedisStore) GetStale(k string) (*v1.Forecast, time.Time, bool) {
+	e, found := c.get(k)
+	if !found || !c.now().Before(e.ExpiresAt.Add(time.Duration(c.defaultGrace.Load()))) {
+		return nil, time.Time{}, false
+	}
+	return e.Value, e.StoredAt, true
+}
+
+// Lookup returns the value with the specified k and the time it was stored if
+// it exists, even if it has expired within the grace window of the store, and
+// whether it is still fresh. It costs a single round trip to Redis.
+func (c *RedisStore) Lookup(k string) (*v1.Forecast, time.Time, bool, bool) {
+	e, found := c.get(k)
+	now := c.now()
+	if !found || !now.Before(e.ExpiresAt) {
+		c.misses.Add(1)
+	} else {
+		c.hits.Add(1)
+	}
+	if !found || !now.Before(e.ExpiresAt.Add(time.Duration(c.defaultGrace.Load()))) {
+		return nil, time.Time{}, false, false
+	}
+	return e.Value, e.StoredAt, now.Before(e.ExpiresAt), true
+}
+
+// Entries returns the entries stored under the prefix of the store, without
+// their values.
+func (c *RedisStore) Entries(ctx context.Context) ([]ForecastEntry, error) {
+	var entries []ForecastEntry
+	err := c.scan(ctx, "", func(keys []string) error {
+		values, err := c.client.MGet(ctx, keys...).Result()
+		if err != nil {
+			return err
+		}
+		for i, v := range values {
+			s, ok := v.(string)
+			if !ok {
+				// expired since the scan
+				continue
+			}
+			var e redisEntry
+			if err := json.Unmarshal([]byte(s), &e); err != nil {
+				c.logger.Warnw("Failed to decode cache entry", "error", err, "key", keys[i])
+				continue
+			}
+			entries = append(entries, ForecastEntry{
+				Key:       strings.TrimPrefix(keys[i], c.prefix),
+				StoredAt:  e.StoredAt,
+				ExpiresAt: e.ExpiresAt,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing redis entries: %w", err)
+	}
+	return entries, nil
+}
+
+// Peek returns the entry with the specified k, even if it has expired. It
+// returns nil if no entry exists.
+func (c *RedisStore) Peek(ctx context.Context, k string) (*ForecastEntry, error) {
+	b, err := c.client.Get(ctx, c.prefix+k).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getting redis entry: %w", err)
+	}
+
+	var e redisEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, fmt.Errorf("decoding redis entry: %w", err)
+	}
+	return &ForecastEntry{
+		Key:       k,
+		Value:     e.Value,
+		StoredAt:  e.StoredAt,
+		ExpiresAt: e.ExpiresAt,
+	}, nil
+}
+
+// Delete removes the entry with the specified k and reports whether it
+// existed.
+func (c *RedisStore) Delete(ctx context.Context, k string) (bool, error) {
+	n, err := c.client.Del(ctx, c.prefix+k).Result()
+	if err != nil {
+		return false, fmt.Errorf("deleting redis entry: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Purge removes the entries whose key starts with prefix and returns how many
+// were removed. The keys are unlinked in batches as they are scanned, so that
+// purging costs a round trip per batch rather than per entry.
+func (c *RedisStore) Purge(ctx context.Context, prefix string) (int, error) {
+	n, err := c.unlink(ctx, prefix)
+	if err != nil {
+		return n, fmt.Errorf("purging redis entries: %w", err)
+	}
+	return n, nil
+}
+
+// Flush removes all entries stored under the prefix of the store and returns
+// how many were removed. Keys outside the prefix are left untouched.
+func (c *RedisStore) Flush(ctx context.Context) (int, error) {
+	n, err := c.unlink(ctx, "")
+	if err != nil {
+		return n, fmt.Errorf("flushing redis entries: %w", err)
+	}
+	return n, nil
+}
+
+// Stats returns the counters of the store. Hits and misses are counted by
+// this process only, while entries are counted in Redis at most once per
+// redisStatsInterval.
+func (c *RedisStore) Stats() Stats {
+	return Stats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: c.entries(),
+	}
+}
+
+// SetTTL changes the TTL of the entries stored from now on without a TTL of
+// their own.
+func (c *RedisStore) SetTTL(ttl time.Duration) {
+	c.defaultTTL.Store(int64(ttl))
+}
+
+// SetGrace changes the grace window during which expired entries are still
+// served. Entries stored before the change are kept by Redis for the grace
+// window they were stored with.
+func (c *RedisStore) SetGrace(grace time.Duration) {
+	c.defaultGrace.Store(int64(grace))
+}
+
+// Ping checks the connection to Redis.
+func (c *RedisStore) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
+
+func (c *RedisStore) get(k string) (*redisEntry, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.opTimeout)
+	defer cancel()
+	b, err := c.client.Get(ctx, c.prefix+k).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false
+	}
+	if err != nil {
+		c.logger.Warnw("Failed to retrieve cache entry from redis", "error", err, "key", k)
+		return nil, false
+	}
+
+	var e redisEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		c.logger.Warnw("Failed to decode cache entry", "error", err, "key", k)
+		return nil, false
+	}
+	return &e, true
+}
+
+// entries returns the number of entries stored under the prefix of the store.
+// The count is reused until it is older than redisStatsInterval, and callers
+// arriving while it is being refreshed get the previous count.
+func (c *RedisStore) entries() int {
+	c.countMu.Lock()
+	if c.counting || c.now().Sub(c.countedAt) < redisStatsInterval {
+		defer c.countMu.Unlock()
+		return c.count
+	}
+	c.counting = true
+	c.countMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisStatsTimeout)
+	defer cancel()
+	var n int
+	err := c.scan(ctx, "", func(keys []string) error {
+		n += len(keys)
+		return nil
+	})
+
+	c.countMu.Lock()
+	defer c.countMu.Unlock()
+	c.counting = false
+	c.countedAt = c.now()
+	if err != nil {
+		c.logger.Warnw("Failed to count redis entries", "error", err)
+		return c.count
+	}
+	c.count = n
+	return n
+}
+
+// unlink removes the entries whose key starts with prefix, in batches, and
+// returns how many were removed.
+func (c *RedisStore) unlink(ctx context.Context, prefix string) (int, error) {
+	var deleted int
+	err := c.scan(ctx, prefix, func(keys []string) error {
+		n, err := c.client.Unlink(ctx, keys...).Result()
+		deleted += int(n)
+		return err
+	})
+	return deleted, err
+}
+
+// scan calls fn with batches of the keys stored under the prefix of the store
+// and starting with prefix.
+func (c *RedisStore) scan(ctx context.Context, prefix string, fn func(keys []string) error) error {
+	match := escapeGlob(c.prefix+prefix) + "*"
+	var cursor uint64
+	for {
+		keys, next, err := c.client.Scan(ctx, cursor, match, redisScanCount).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// escapeGlob escapes the characters of s which have a special meaning in a
+// redis glob-style pattern.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
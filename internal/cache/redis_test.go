@@ -0,0 +1,174 @@
+package cache
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	v1 "github.com/cityhunteur/weather-service/api/v1"
+)
+
+func newTestRedisStore(t *testing.T, opts ...Option) (*RedisStore, *miniredis.Miniredis, *fakeClock) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	clock := &fakeClock{t: time.Date(2023, 6, 29, 21, 0, 0, 0, time.UTC)}
+	c := NewRedisStore(client, zaptest.NewLogger(t).Sugar(), opts...)
+	c.now = clock.Now
+	return c, mr, clock
+}
+
+func TestRedisStore_Get(t *testing.T) {
+	t.Parallel()
+	c, mr, _ := newTestRedisStore(t, WithTTL(time.Hour), WithGrace(30*time.Minute), WithPrefix("weather:"))
+	want := &v1.Forecast{
+		Name:   "New York",
+		Detail: []*v1.Detail{{Description: "Haze."}},
+	}
+	c.Set("new york", want, 0)
+
+	assert.True(t, mr.Exists("weather:new york"))
+	assert.Equal(t, 90*time.Minute, mr.TTL("weather:new york"))
+
+	got, found := c.Get("new york")
+	assert.True(t, found)
+	assert.Equal(t, want, got)
+	got, _, fresh, found := c.Lookup("new york")
+	assert.True(t, found)
+	assert.True(t, fresh)
+	assert.Equal(t, want, got)
+
+	_, found = c.Get("chicago")
+	assert.False(t, found)
+}
+
+func TestRedisStore_SetTTL(t *testing.T) {
+	t.Parallel()
+	c, mr, _ := newTestRedisStore(t, WithTTL(time.Hour), WithGrace(30*time.Minute))
+	c.SetTTL(10 * time.Minute)
+	c.Set("new york", &v1.Forecast{Name: "New York"}, 0)
+
+	assert.Equal(t, 40*time.Minute, mr.TTL("new york"))
+}
+
+func TestRedisStore_SetGrace(t *testing.T) {
+	t.Parallel()
+	c, mr, _ := newTestRedisStore(t, WithTTL(time.Hour), WithGrace(30*time.Minute))
+	c.SetGrace(10 * time.Minute)
+	c.Set("new york", &v1.Forecast{Name: "New York"}, 0)
+
+	assert.Equal(t, 70*time.Minute, mr.TTL("new york"))
+}
+
+func TestRedisStore_GetStale(t *testing.T) {
+	t.Parallel()
+	c, mr, clock := newTestRedisStore(t, WithTTL(time.Hour), WithGrace(30*time.Minute))
+	storedAt := clock.Now()
+	c.Set("new york", &v1.Forecast{Name: "New York"}, 0)
+
+	clock.Add(80 * time.Minute)
+	mr.FastForward(80 * time.Minute)
+	_, found := c.Get("new york")
+	assert.False(t, found)
+	got, gotStoredAt, found := c.GetStale("new york")
+	assert.True(t, found)
+	assert.Equal(t, "New York", got.Name)
+	assert.True(t, storedAt.Equal(gotStoredAt))
+	got, gotStoredAt, fresh, found := c.Lookup("new york")
+	assert.True(t, found)
+	assert.False(t, fresh)
+	assert.Equal(t, "New York", got.Name)
+	assert.True(t, storedAt.Equal(gotStoredAt))
+
+	mr.FastForward(10 * time.Minute)
+	_, _, found = c.GetStale("new york")
+	assert.False(t, found)
+	_, _, _, found = c.Lookup("new york")
+	assert.False(t, found)
+}
+
+func TestRedisStore_Unavailable(t *testing.T) {
+	t.Parallel()
+	c, mr, _ := newTestRedisStore(t)
+	mr.Close()
+
+	c.Set("new york", &v1.Forecast{Name: "New York"}, 0)
+	_, found := c.Get("new york")
+	assert.False(t, found)
+}
+
+func TestRedisStore_Slow(t *testing.T) {
+	t.Parallel()
+	// a server accepting connections but never answering
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+	client := redis.NewClient(&redis.Options{
+		Addr:                  ln.Addr().String(),
+		ContextTimeoutEnabled: true,
+	})
+	t.Cleanup(func() { _ = client.Close() })
+	c := NewRedisStore(client, zaptest.NewLogger(t).Sugar())
+	c.opTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	c.Set("new york", &v1.Forecast{Name: "New York"}, 0)
+	_, found := c.Get("new york")
+	assert.False(t, found)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestRedisStore_Admin(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	c, mr, clock := newTestRedisStore(t, WithTTL(time.Hour), WithPrefix("weather:*"))
+	require.NoError(t, mr.Set("other", "value"))
+	c.Set("OKX/33,35", &v1.Forecast{Name: "New York"}, 0)
+	c.Set("LOX/154,44", &v1.Forecast{Name: "Los Angeles"}, 0)
+	c.Get("OKX/33,35")
+	c.Get("LOT/76,73")
+
+	entries, err := c.Entries(ctx)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"OKX/33,35", "LOX/154,44"}, []string{entries[0].Key, entries[1].Key})
+	assert.True(t, clock.Now().Add(time.Hour).Equal(entries[0].ExpiresAt))
+
+	e, err := c.Peek(ctx, "OKX/33,35")
+	assert.NoError(t, err)
+	assert.Equal(t, "New York", e.Value.Name)
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, 2, stats.Entries)
+
+	deleted, err := c.Delete(ctx, "OKX/33,35")
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+
+	c.Set("LOT/76,73", &v1.Forecast{Name: "Chicago"}, 0)
+	purged, err := c.Purge(ctx, "LOT/")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	assert.False(t, mr.Exists("weather:*LOT/76,73"))
+	assert.True(t, mr.Exists("weather:*LOX/154,44"))
+
+	// entries are counted again only once the count is stale
+	assert.Equal(t, 2, c.Stats().Entries)
+	clock.Add(redisStatsInterval)
+	assert.Equal(t, 1, c.Stats().Entries)
+
+	n, err := c.Flush(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.True(t, mr.Exists("other"))
+}
@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshotMagic starts the header line of a snapshot file, followed by the
+// SHA-256 checksum of the JSON payload on the following lines.
+const snapshotMagic = "weather-service-cache/v1"
+
+// ErrCorruptSnapshot is returned when a snapshot file is truncated or
+// otherwise corrupt.
+var ErrCorruptSnapshot = errors.New("corrupt cache snapshot")
+
+type snapshotEntry[K comparable, V any] struct {
+	Key       K         `json:"key"`
+	Value     V         `json:"value"`
+	StoredAt  time.Time `json:"storedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// SaveSnapshot writes the entries of the store, from most to least recently
+// used, to the file at path. Keys and values are encoded as JSON. The file is
+// replaced atomically so that a crash while saving never leaves a partial
+// snapshot behind.
+func (c *Store[K, V]) SaveSnapshot(path string) error {
+	c.mu.Lock()
+	entries := make([]snapshotEntry[K, V], 0, c.lru.Len())
+	for el := c.lru.Front(); el != nil; el = el.Next() {
+		e := el.Value.(*entry[K, V])
+		entries = append(entries, snapshotEntry[K, V]{
+			Key:       e.key,
+			Value:     e.value,
+			StoredAt:  e.storedAt,
+			ExpiresAt: e.expiresAt,
+		})
+	}
+	c.mu.Unlock()
+
+	payload, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("encoding snapshot: %w", err)
+	}
+	sum := sha256.Sum256(payload)
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("creating snapshot file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	_, err = fmt.Fprintf(tmp, "%s %s\n%s", snapshotMagic, hex.EncodeToString(sum[:]), payload)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing snapshot file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing snapshot file: %w", err)
+	}
+	return nil
+}
+
+// LoadSnapshot adds the entries of the snapshot at path which have not
+// expired beyond the grace window of the store, and returns how many were
+// added. A missing file is not an error. ErrCorruptSnapshot is returned if
+// the file cannot be trusted, in which case nothing is added.
+func (c *Store[K, V]) LoadSnapshot(path string) (int, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("reading snapshot file: %w", err)
+	}
+
+	header, payload, found := bytes.Cut(b, []byte("\n"))
+	if !found {
+		return 0, fmt.Errorf("%w: missing header", ErrCorruptSnapshot)
+	}
+	magic, checksum, _ := bytes.Cut(header, []byte(" "))
+	if string(magic) != snapshotMagic {
+		return 0, fmt.Errorf("%w: unsupported format %q", ErrCorruptSnapshot, magic)
+	}
+	sum := sha256.Sum256(payload)
+	if string(checksum) != hex.EncodeToString(sum[:]) {
+		return 0, fmt.Errorf("%w: checksum mismatch", ErrCorruptSnapshot)
+	}
+
+	var entries []snapshotEntry[K, V]
+	if err := json.Unmarshal(payload, &entries); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+	}
+
+	now := c.now()
+	loaded := 0
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// insert from least to most recently used to restore the eviction order
+	for i := len(entries) - 1; i >= 0; i-- {
+		se := entries[i]
+		if !now.Before(se.ExpiresAt.Add(c.grace)) {
+			continue
+		}
+		c.insert(&entry[K, V]{
+			key:       se.Key,
+			value:     se.Value,
+			size:      c.sizeOf(se.Key, se.Value),
+			storedAt:  se.StoredAt,
+			expiresAt: se.ExpiresAt,
+		})
+		loaded++
+	}
+	return loaded, nil
+}
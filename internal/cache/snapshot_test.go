@@ -0,0 +1,98 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/cityhunteur/weather-service/api/v1"
+)
+
+func TestStore_Snapshot(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	c, clock := newTestStore(WithTTL(time.Hour), WithGrace(10*time.Minute))
+	c.Set("new york", &v1.Forecast{Name: "New York", Detail: []*v1.Detail{{Description: "Haze."}}}, 0)
+	c.Set("chicago", &v1.Forecast{Name: "Chicago"}, 3*time.Hour)
+	c.Set("los angeles", &v1.Forecast{Name: "Los Angeles"}, 2*time.Hour)
+	require.NoError(t, c.SaveSnapshot(path))
+
+	// new york has expired beyond the grace window by the time we restart
+	restored, restoredClock := newTestStore(WithTTL(time.Hour), WithGrace(10*time.Minute), WithCapacity(2))
+	restoredClock.t = clock.Now().Add(90 * time.Minute)
+	n, err := restored.LoadSnapshot(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	got, found := restored.Get("los angeles")
+	assert.True(t, found)
+	assert.Equal(t, "Los Angeles", got.Name)
+	_, _, found = restored.GetStale("new york")
+	assert.False(t, found)
+
+	// the eviction order is restored
+	restored.Set("seattle", &v1.Forecast{Name: "Seattle"}, 0)
+	_, found = restored.Get("chicago")
+	assert.False(t, found)
+	_, found = restored.Get("los angeles")
+	assert.True(t, found)
+}
+
+func TestStore_LoadSnapshot_Invalid(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.snapshot")
+	c, _ := newTestStore()
+	c.Set("new york", &v1.Forecast{Name: "New York"}, 0)
+	require.NoError(t, c.SaveSnapshot(valid))
+	b, err := os.ReadFile(valid)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{
+			name:    "truncated",
+			content: b[:len(b)-5],
+		},
+		{
+			name:    "tampered",
+			content: append(append([]byte{}, b[:len(b)-3]...), []byte(`"]}`)...),
+		},
+		{
+			name:    "no header",
+			content: []byte(`[{"key":"new york"}]`),
+		},
+		{
+			name:    "empty",
+			content: []byte{},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(dir, tt.name+".snapshot")
+			require.NoError(t, os.WriteFile(path, tt.content, 0o600))
+
+			c := NewStore[string, *v1.Forecast]()
+			n, err := c.LoadSnapshot(path)
+			assert.ErrorIs(t, err, ErrCorruptSnapshot)
+			assert.Zero(t, n)
+			assert.Zero(t, c.Len())
+		})
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		t.Parallel()
+		n, err := NewStore[string, *v1.Forecast]().LoadSnapshot(filepath.Join(dir, "missing.snapshot"))
+		assert.NoError(t, err)
+		assert.Zero(t, n)
+	})
+}
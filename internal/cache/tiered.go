@@ -0,0 +1,181 @@
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	v1 "github.com/cityhunteur/weather-service/api/v1"
+)
+
+// Backend is a forecast cache which can be used as the shared tier of a
+// Tiered cache, e.g. a RedisStore.
+type Backend interface {
+	Set(k string, v *v1.Forecast, ttl time.Duration)
+	Get(k string) (*v1.Forecast, bool)
+	GetStale(k string) (*v1.Forecast, time.Time, bool)
+	Lookup(k string) (*v1.Forecast, time.Time, bool, bool)
+
+	Entries(ctx context.Context) ([]ForecastEntry, error)
+	Peek(ctx context.Context, k string) (*ForecastEntry, error)
+	Delete(ctx context.Context, k string) (bool, error)
+	Purge(ctx context.Context, prefix string) (int, error)
+	Flush(ctx context.Context) (int, error)
+	Stats() Stats
+}
+
+// Tiered is a two-tier cache which checks a small in-process Store before
+// falling back to a shared Backend. Entries read from the shared tier are
+// copied into the in-process tier for a short TTL, so that hot keys do not
+// cost a network round trip while replicas still converge quickly after an
+// update. As a consequence, an entry may be served by the in-process tier for
+// up to that TTL after it expired in the shared tier.
+type Tiered struct {
+	l1 *ForecastStore
+	l2 Backend
+	// ttl is the TTL of the shared tier, which bounds the in-process TTL of
+	// the entries stored without a TTL of their own.
+	ttl atomic.Int64
+	// l1TTL is the maximum duration entries are kept in the in-process tier.
+	l1TTL atomic.Int64
+}
+
+// NewTiered creates a new Tiered cache storing entries in l1 for at most l1TTL,
+// in front of l2 whose TTL is ttl.
+func NewTiered(l1 *ForecastStore, l2 Backend, ttl, l1TTL time.Duration) *Tiered {
+	c := &Tiered{
+		l1: l1,
+		l2: l2,
+	}
+	c.ttl.Store(int64(ttl))
+	c.l1TTL.Store(int64(l1TTL))
+	return c
+}
+
+// Set adds the given value v to both tiers using the specified k.
+func (c *Tiered) Set(k string, v *v1.Forecast, ttl time.Duration) {
+	c.l2.Set(k, v, ttl)
+	c.l1.Set(k, v, c.l1EntryTTL(ttl))
+}
+
+// Get return the value with the specified k if it exists and has not expired
+// in either tier, populating the in-process tier on a shared tier hit.
+func (c *Tiered) Get(k string) (*v1.Forecast, bool) {
+	if v, found := c.l1.Get(k); found {
+		return v, true
+	}
+	v, found := c.l2.Get(k)
+	if !found {
+		return nil, false
+	}
+	c.l1.Set(k, v, time.Duration(c.l1TTL.Load()))
+	return v, true
+}
+
+// GetStale returns the value with the specified k from the shared tier, which
+// tracks when the entry was originally stored.
+func (c *Tiered) GetStale(k string) (*v1.Forecast, time.Time, bool) {
+	return c.l2.GetStale(k)
+}
+
+// Lookup returns the value with the specified k, the time it was stored and
+// whether it is still fresh, from the in-process tier if fresh there and from
+// the shared tier otherwise, populating the in-process tier on a fresh shared
+// tier hit. The time of in-process hits is when they were copied from the
+// shared tier.
+func (c *Tiered) Lookup(k string) (*v1.Forecast, time.Time, bool, bool) {
+	if v, storedAt, fresh, _ := c.l1.Lookup(k); fresh {
+		return v, storedAt, true, true
+	}
+	v, storedAt, fresh, found := c.l2.Lookup(k)
+	if fresh {
+		c.l1.Set(k, v, time.Duration(c.l1TTL.Load()))
+	}
+	return v, storedAt, fresh, found
+}
+
+// Entries returns the entries of the shared tier, without their values.
+func (c *Tiered) Entries(ctx context.Context) ([]ForecastEntry, error) {
+	return c.l2.Entries(ctx)
+}
+
+// Peek returns the entry with the specified k from the shared tier.
+func (c *Tiered) Peek(ctx context.Context, k string) (*ForecastEntry, error) {
+	return c.l2.Peek(ctx, k)
+}
+
+// Delete removes the entry with the specified k from both tiers and reports
+// whether it existed in the shared tier. Other replicas may keep serving the
+// entry from their in-process tier until it expires there.
+func (c *Tiered) Delete(ctx context.Context, k string) (bool, error) {
+	_, _ = c.l1.Delete(ctx, k)
+	return c.l2.Delete(ctx, k)
+}
+
+// Purge removes the entries whose key starts with prefix from both tiers and
+// returns how many were removed from the shared tier.
+func (c *Tiered) Purge(ctx context.Context, prefix string) (int, error) {
+	_, _ = c.l1.Purge(ctx, prefix)
+	return c.l2.Purge(ctx, prefix)
+}
+
+// Flush removes all entries from both tiers and returns how many were
+// removed from the shared tier.
+func (c *Tiered) Flush(ctx context.Context) (int, error) {
+	_, _ = c.l1.Flush(ctx)
+	return c.l2.Flush(ctx)
+}
+
+// Stats returns the counters of the shared tier, with the hits and
+// evictions of the in-process tier added.
+func (c *Tiered) Stats() Stats {
+	stats := c.l2.Stats()
+	l1 := c.l1.Stats()
+	stats.Hits += l1.Hits
+	stats.Evictions += l1.Evictions
+	return stats
+}
+
+// l1EntryTTL returns the in-process TTL of an entry stored in the shared tier
+// for ttl, or for the TTL of the shared tier if ttl is not positive.
+func (c *Tiered) l1EntryTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		ttl = time.Duration(c.ttl.Load())
+	}
+	if l1TTL := time.Duration(c.l1TTL.Load()); ttl > l1TTL {
+		return l1TTL
+	}
+	return ttl
+}
+
+// SetTTL changes the TTL of the shared tier, if it supports it, and of the
+// in-process copies of the entries stored from now on without a TTL of their
+// own.
+func (c *Tiered) SetTTL(ttl time.Duration) {
+	if s, ok := c.l2.(interface{ SetTTL(time.Duration) }); ok {
+		s.SetTTL(ttl)
+	}
+	c.ttl.Store(int64(ttl))
+}
+
+// SetL1TTL changes the maximum duration entries copied from now on are kept in
+// the in-process tier.
+func (c *Tiered) SetL1TTL(ttl time.Duration) {
+	c.l1TTL.Store(int64(ttl))
+}
+
+// SetGrace changes the grace window of the shared tier, if it supports it,
+// which serves the expired entries.
+func (c *Tiered) SetGrace(grace time.Duration) {
+	if s, ok := c.l2.(interface{ SetGrace(time.Duration) }); ok {
+		s.SetGrace(grace)
+	}
+}
+
+// Ping checks the connection to the shared tier, if it has one.
+func (c *Tiered) Ping(ctx context.Context) error {
+	if p, ok := c.l2.(interface{ Ping(context.Context) error }); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
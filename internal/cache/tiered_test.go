@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	v1 "github.com/cityhunteur/weather-service/api/v1"
+)
+
+func TestTiered(t *testing.T) {
+	t.Parallel()
+	l1, l1Clock := newTestStore(WithCapacity(10))
+	l2, l2Clock := newTestStore(WithTTL(time.Hour), WithGrace(30*time.Minute))
+	c := NewTiered(l1, l2, time.Hour, time.Minute)
+
+	// entries written through both tiers expire sooner in l1
+	c.Set("new york", &v1.Forecast{Name: "New York"}, 0)
+	_, found := l1.Get("new york")
+	assert.True(t, found)
+	l1Clock.Add(time.Minute)
+	_, found = l1.Get("new york")
+	assert.False(t, found)
+
+	// reads fall back to l2 and populate l1
+	got, found := c.Get("new york")
+	assert.True(t, found)
+	assert.Equal(t, "New York", got.Name)
+	_, found = l1.Get("new york")
+	assert.True(t, found)
+
+	// updates from another replica become visible once l1 expires
+	l2.Set("new york", &v1.Forecast{Name: "New York, NY"}, 0)
+	got, _ = c.Get("new york")
+	assert.Equal(t, "New York", got.Name)
+	l1Clock.Add(time.Minute)
+	got, _ = c.Get("new york")
+	assert.Equal(t, "New York, NY", got.Name)
+
+	// stale entries are served from l2
+	l2Clock.Add(80 * time.Minute)
+	l1Clock.Add(time.Minute)
+	_, found = c.Get("new york")
+	assert.False(t, found)
+	_, _, found = c.GetStale("new york")
+	assert.True(t, found)
+	got, _, fresh, found := c.Lookup("new york")
+	assert.True(t, found)
+	assert.False(t, fresh)
+	assert.Equal(t, "New York, NY", got.Name)
+
+	// fresh lookups in l2 populate l1
+	c.Set("chicago", &v1.Forecast{Name: "Chicago"}, 0)
+	l1Clock.Add(time.Minute)
+	_, _, fresh, _ = c.Lookup("chicago")
+	assert.True(t, fresh)
+	_, found = l1.Get("chicago")
+	assert.True(t, found)
+}
+
+func TestTiered_SetTTL(t *testing.T) {
+	t.Parallel()
+	l1, l1Clock := newTestStore(WithCapacity(10))
+	l2, l2Clock := newTestStore(WithTTL(time.Hour), WithGrace(30*time.Minute))
+	c := NewTiered(l1, l2, time.Hour, time.Minute)
+
+	// a shared TTL shorter than the in-process one bounds both tiers
+	c.SetTTL(30 * time.Second)
+	c.Set("new york", &v1.Forecast{Name: "New York"}, 0)
+	l1Clock.Add(30 * time.Second)
+	l2Clock.Add(30 * time.Second)
+	_, found := l1.Get("new york")
+	assert.False(t, found)
+	_, found = l2.Get("new york")
+	assert.False(t, found)
+
+	c.SetL1TTL(10 * time.Second)
+	c.SetTTL(time.Hour)
+	c.Set("chicago", &v1.Forecast{Name: "Chicago"}, 0)
+	l1Clock.Add(10 * time.Second)
+	_, found = l1.Get("chicago")
+	assert.False(t, found)
+
+	// the grace window is the one of the shared tier
+	c.SetGrace(0)
+	l2Clock.Add(time.Hour)
+	_, _, found = c.GetStale("chicago")
+	assert.False(t, found)
+}
+
+func TestTiered_Ping(t *testing.T) {
+	t.Parallel()
+	l1, _ := newTestStore()
+	l2, mr, _ := newTestRedisStore(t)
+	c := NewTiered(l1, l2, time.Hour, time.Minute)
+
+	assert.NoError(t, c.Ping(context.Background()))
+	mr.Close()
+	assert.Error(t, c.Ping(context.Background()))
+
+	// a shared tier without a connection is always reachable
+	memory, _ := newTestStore()
+	assert.NoError(t, NewTiered(l1, memory, time.Hour, time.Minute).Ping(context.Background()))
+}
@@ -0,0 +1,415 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/cityhunteur/weather-service/internal/cache"
+	"github.com/cityhunteur/weather-service/internal/cors"
+	"github.com/cityhunteur/weather-service/internal/handler"
+	"github.com/cityhunteur/weather-service/internal/tlsconfig"
+)
+
+// Config is the configuration of the service.
+//
+// Each setting is read, in increasing order of precedence, from its default,
+// the optional YAML config file, the WEATHER_* environment variable named
+// after its flag, e.g. WEATHER_CACHE_BACKEND for -cache-backend, and its flag.
+type Config struct {
+	Server    Server    `yaml:"server"`
+	Handler   Handler   `yaml:"handler"`
+	Upstream  Upstream  `yaml:"upstream"`
+	Cache     Cache     `yaml:"cache"`
+	Tracing   Tracing   `yaml:"tracing"`
+	Log       Log       `yaml:"log"`
+	Auth      Auth      `yaml:"auth"`
+	RateLimit RateLimit `yaml:"rateLimit"`
+	Usage     Usage     `yaml:"usage"`
+	CORS      CORS      `yaml:"cors"`
+	Admission Admission `yaml:"admission"`
+}
+
+// Server configures the HTTP server.
+type Server struct {
+	Addr              string        `yaml:"addr" flag:"addr" usage:"Address the server listens on."`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout" flag:"read-header-timeout" usage:"Maximum duration to read the headers of a request."`
+	ShutdownTimeout   time.Duration `yaml:"shutdownTimeout" flag:"shutdown-timeout" usage:"Maximum duration to complete the requests in flight on shutdown."`
+	DrainDelay        time.Duration `yaml:"drainDelay" flag:"shutdown-drain-delay" usage:"Duration the service reports not ready before shutting down, so that load balancers drain traffic."`
+	TrustedProxies    string        `yaml:"trustedProxies" flag:"trusted-proxies" usage:"Comma separated IPs or CIDRs of the proxies whose X-Forwarded-For header is trusted for the client IP, empty to use the peer address."`
+
+	TLS TLS `yaml:"tls"`
+}
+
+// Proxies returns the trusted proxies.
+func (s *Server) Proxies() []string {
+	return splitList(s.TrustedProxies)
+}
+
+// TLS configures the TLS of the server, which serves plain HTTP unless a
+// certificate is set.
+type TLS struct {
+	CertFile       string        `yaml:"certFile" flag:"tls-cert-file" usage:"Path of the PEM encoded certificate chain of the server, empty to serve plain HTTP."`
+	KeyFile        string        `yaml:"keyFile" flag:"tls-key-file" usage:"Path of the PEM encoded private key of the server."`
+	MinVersion     string        `yaml:"minVersion" flag:"tls-min-version" usage:"Minimum TLS version accepted, either 1.2 or 1.3."`
+	ClientCAFile   string        `yaml:"clientCAFile" flag:"tls-client-ca-file" usage:"Path of the PEM encoded CAs verifying client certificates, empty to not require client certificates."`
+	ReloadInterval time.Duration `yaml:"reloadInterval" flag:"tls-reload-interval" usage:"Interval at which the certificate files are checked for changes."`
+}
+
+// Enabled reports whether the server serves TLS.
+func (t *TLS) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// Handler configures the forecast handler.
+type Handler struct {
+	Timeout time.Duration `yaml:"timeout" flag:"request-timeout" usage:"Maximum duration to get the forecasts of a request, which clients can lower with the X-Request-Timeout header or the timeout query param."`
+	Country string        `yaml:"country" flag:"country" usage:"Country cities are searched in."`
+}
+
+// Upstream configures the upstream APIs.
+type Upstream struct {
+	OpenStreetMapURL string        `yaml:"openStreetMapURL" flag:"openstreetmap-url" usage:"Base URL of the OpenStreetMap Nominatim API, e.g. a self-hosted instance."`
+	WeatherGovURL    string        `yaml:"weatherGovURL" flag:"weathergov-url" usage:"Base URL of the weather.gov API."`
+	Timeout          time.Duration `yaml:"timeout" flag:"upstream-timeout" usage:"Maximum duration of each call to the upstream APIs, within the timeout of the request."`
+}
+
+// Cache configures the forecast cache.
+type Cache struct {
+	Backend  string        `yaml:"backend" flag:"cache-backend" usage:"Cache backend for forecasts, either memory or redis."`
+	TTL      time.Duration `yaml:"ttl" flag:"cache-ttl" usage:"Duration forecasts are cached when upstream does not advertise their freshness."`
+	Capacity int           `yaml:"capacity" flag:"cache-capacity" usage:"Maximum number of forecasts in the memory cache backend."`
+	MaxBytes int           `yaml:"maxBytes" flag:"cache-max-bytes" usage:"Maximum estimated memory used by the forecasts of the memory cache backend, in bytes, 0 for no bound."`
+	Grace    time.Duration `yaml:"grace" flag:"cache-grace" usage:"Duration expired forecasts are served while they are refreshed."`
+
+	Redis    Redis    `yaml:"redis"`
+	L1       L1       `yaml:"l1"`
+	Snapshot Snapshot `yaml:"snapshot"`
+}
+
+// Redis configures the redis cache backend. The password is read from the
+// REDIS_PASSWORD environment variable.
+type Redis struct {
+	Addr     string `yaml:"addr" flag:"redis-addr" usage:"Address of the redis server used by the redis cache backend."`
+	DB       int    `yaml:"db" flag:"redis-db" usage:"Redis database used by the redis cache backend."`
+	Prefix   string `yaml:"prefix" flag:"redis-prefix" usage:"Prefix of the keys stored in redis."`
+	PoolSize int    `yaml:"poolSize" flag:"redis-pool-size" usage:"Maximum number of redis connections, defaults to 10 per CPU."`
+}
+
+// L1 configures the in-process cache in front of a shared cache backend.
+type L1 struct {
+	Capacity int           `yaml:"capacity" flag:"cache-l1-capacity" usage:"Number of forecasts kept in process in front of a shared cache backend, 0 to disable."`
+	TTL      time.Duration `yaml:"ttl" flag:"cache-l1-ttl" usage:"Duration forecasts are kept in process in front of a shared cache backend."`
+}
+
+// Snapshot configures the snapshots of the memory cache backend.
+type Snapshot struct {
+	Path     string        `yaml:"path" flag:"cache-snapshot-path" usage:"File the memory cache backend is saved to and restored from across restarts, empty to disable."`
+	Interval time.Duration `yaml:"interval" flag:"cache-snapshot-interval" usage:"Interval at which the memory cache backend is saved."`
+}
+
+// Tracing configures the export of trace spans.
+type Tracing struct {
+	Exporter string `yaml:"exporter" flag:"trace-exporter" usage:"Exporter of the trace spans, either none, stdout or otlp."`
+}
+
+// Log configures the logger.
+type Log struct {
+	Level string `yaml:"level" flag:"log-level" usage:"Minimum level of the logs, e.g. debug, info or warn."`
+}
+
+// Auth configures the authentication of API consumers.
+type Auth struct {
+	APIKeysFile string `yaml:"apiKeysFile" flag:"api-keys-file" usage:"Path of the YAML file of the API keys required to get forecasts, empty to not require API keys."`
+
+	JWT JWT `yaml:"jwt"`
+}
+
+// JWT configures the authentication of API consumers by bearer JWTs, enabled
+// when a JWKS URL or a key file is set.
+type JWT struct {
+	JWKSURL             string        `yaml:"jwksURL" flag:"jwt-jwks-url" usage:"URL of the JWKS of the identity provider verifying bearer JWTs."`
+	JWKSRefreshInterval time.Duration `yaml:"jwksRefreshInterval" flag:"jwt-jwks-refresh-interval" usage:"Interval at which the JWKS is fetched again."`
+	KeyFile             string        `yaml:"keyFile" flag:"jwt-key-file" usage:"Path of the JWKS or PEM encoded public keys verifying bearer JWTs, instead of a JWKS URL."`
+	Issuer              string        `yaml:"issuer" flag:"jwt-issuer" usage:"Issuer required of bearer JWTs."`
+	Audience            string        `yaml:"audience" flag:"jwt-audience" usage:"Audience required of bearer JWTs."`
+	ReadScope           string        `yaml:"readScope" flag:"jwt-read-scope" usage:"Scope required of bearer JWTs to get forecasts."`
+	AdminScope          string        `yaml:"adminScope" flag:"jwt-admin-scope" usage:"Scope required of bearer JWTs to administer the service."`
+}
+
+// Enabled reports whether consumers can authenticate by bearer JWTs.
+func (j *JWT) Enabled() bool {
+	return j.JWKSURL != "" || j.KeyFile != ""
+}
+
+// RateLimit configures the rate limits of the clients getting forecasts,
+// enforced with token buckets refilled with the given number of requests per
+// period.
+type RateLimit struct {
+	Enabled           bool          `yaml:"enabled" flag:"ratelimit-enabled" usage:"Whether to limit the rate of requests of each client."`
+	Period            time.Duration `yaml:"period" flag:"ratelimit-period" usage:"Period of the rate limits."`
+	ConsumerRequests  int           `yaml:"consumerRequests" flag:"ratelimit-consumer-requests" usage:"Number of requests per period allowed to each authenticated consumer."`
+	ConsumerBurst     int           `yaml:"consumerBurst" flag:"ratelimit-consumer-burst" usage:"Number of requests each authenticated consumer can make at once."`
+	AnonymousRequests int           `yaml:"anonymousRequests" flag:"ratelimit-anonymous-requests" usage:"Number of requests per period allowed to each client IP of unauthenticated requests."`
+	AnonymousBurst    int           `yaml:"anonymousBurst" flag:"ratelimit-anonymous-burst" usage:"Number of requests each client IP of unauthenticated requests can make at once."`
+}
+
+// Usage configures the accounting of the usage of authenticated consumers.
+type Usage struct {
+	Path         string        `yaml:"path" flag:"usage-path" usage:"File the usage of consumers is saved to and restored from across restarts, empty to not persist it."`
+	SaveInterval time.Duration `yaml:"saveInterval" flag:"usage-save-interval" usage:"Interval at which the usage of consumers is saved."`
+	Retention    time.Duration `yaml:"retention" flag:"usage-retention" usage:"Duration the daily usage of consumers is kept."`
+	MonthlyQuota int           `yaml:"monthlyQuota" flag:"usage-monthly-quota" usage:"Number of requests allowed to each consumer per calendar month, 0 for no quota."`
+	QuotaMode    string        `yaml:"quotaMode" flag:"usage-quota-mode" usage:"Action on consumers over their monthly quota, either warn or block."`
+}
+
+// CORS configures the Cross-Origin Resource Sharing of the API with browser
+// clients. Lists are comma separated.
+type CORS struct {
+	AllowedOrigins   string        `yaml:"allowedOrigins" flag:"cors-allowed-origins" usage:"Origins allowed to call the API from browsers, e.g. https://*.example.com, empty to disable CORS."`
+	AllowedMethods   string        `yaml:"allowedMethods" flag:"cors-allowed-methods" usage:"Methods allowed to cross-origin requests."`
+	AllowedHeaders   string        `yaml:"allowedHeaders" flag:"cors-allowed-headers" usage:"Request headers allowed to cross-origin requests."`
+	ExposedHeaders   string        `yaml:"exposedHeaders" flag:"cors-exposed-headers" usage:"Response headers exposed to browser clients."`
+	AllowCredentials bool          `yaml:"allowCredentials" flag:"cors-allow-credentials" usage:"Whether cross-origin requests can carry credentials."`
+	MaxAge           time.Duration `yaml:"maxAge" flag:"cors-max-age" usage:"Duration browsers cache the result of preflight requests."`
+}
+
+// Enabled reports whether the API allows cross-origin requests.
+func (c *CORS) Enabled() bool {
+	return c.AllowedOrigins != ""
+}
+
+// Policy returns the CORS config of the API.
+func (c *CORS) Policy() *cors.Config {
+	return &cors.Config{
+		AllowedOrigins:   splitList(c.AllowedOrigins),
+		AllowedMethods:   splitList(c.AllowedMethods),
+		AllowedHeaders:   splitList(c.AllowedHeaders),
+		ExposedHeaders:   splitList(c.ExposedHeaders),
+		AllowCredentials: c.AllowCredentials,
+		MaxAge:           c.MaxAge,
+	}
+}
+
+// Admission configures the admission control of the requests calling upstream
+// APIs, whose number in flight is bounded by a limit adapted to their latency.
+type Admission struct {
+	Enabled       bool          `yaml:"enabled" flag:"admission-enabled" usage:"Whether to shed the requests calling upstream APIs beyond the concurrency limit."`
+	InitialLimit  int           `yaml:"initialLimit" flag:"admission-initial-limit" usage:"Initial number of requests calling upstream APIs concurrently."`
+	MinLimit      int           `yaml:"minLimit" flag:"admission-min-limit" usage:"Minimum of the adaptive concurrency limit."`
+	MaxLimit      int           `yaml:"maxLimit" flag:"admission-max-limit" usage:"Maximum of the adaptive concurrency limit."`
+	TargetLatency time.Duration `yaml:"targetLatency" flag:"admission-target-latency" usage:"Latency of requests above which the concurrency limit shrinks."`
+	QueueSize     int           `yaml:"queueSize" flag:"admission-queue-size" usage:"Number of requests waiting for the concurrency limit before new ones are shed."`
+	QueueTimeout  time.Duration `yaml:"queueTimeout" flag:"admission-queue-timeout" usage:"Maximum duration requests wait for the concurrency limit before being shed."`
+}
+
+// Default returns the default configuration.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Addr:              ":8080",
+			ReadHeaderTimeout: 5 * time.Second,
+			ShutdownTimeout:   5 * time.Second,
+			DrainDelay:        5 * time.Second,
+			TLS: TLS{
+				MinVersion:     "1.2",
+				ReloadInterval: 10 * time.Second,
+			},
+		},
+		Handler: Handler{
+			Timeout: handler.DefaultTimeout,
+			Country: handler.DefaultCountry,
+		},
+		Upstream: Upstream{
+			OpenStreetMapURL: "https://nominatim.openstreetmap.org/",
+			WeatherGovURL:    "https://api.weather.gov/",
+			Timeout:          5 * time.Second,
+		},
+		Cache: Cache{
+			Backend:  "memory",
+			TTL:      cache.DefaultTTL,
+			Capacity: cache.DefaultCapacity,
+			Grace:    30 * time.Minute,
+			Redis: Redis{
+				Addr:   "localhost:6379",
+				Prefix: "weather-service:forecast:",
+			},
+			L1: L1{
+				Capacity: 100,
+				TTL:      time.Minute,
+			},
+			Snapshot: Snapshot{
+				Interval: 5 * time.Minute,
+			},
+		},
+		Tracing: Tracing{
+			Exporter: "none",
+		},
+		Log: Log{
+			Level: "info",
+		},
+		Auth: Auth{
+			JWT: JWT{
+				JWKSRefreshInterval: time.Hour,
+				ReadScope:           "weather:read",
+				AdminScope:          "weather:admin",
+			},
+		},
+		RateLimit: RateLimit{
+			Period:            time.Minute,
+			ConsumerRequests:  600,
+			ConsumerBurst:     60,
+			AnonymousRequests: 60,
+			AnonymousBurst:    10,
+		},
+		Usage: Usage{
+			SaveInterval: time.Minute,
+			Retention:    400 * 24 * time.Hour,
+			QuotaMode:    "warn",
+		},
+		CORS: CORS{
+			AllowedMethods: "GET,HEAD",
+			AllowedHeaders: "Authorization,X-API-Key,X-Request-ID,X-Request-Timeout",
+			ExposedHeaders: "X-Request-ID,Retry-After,RateLimit-Limit,RateLimit-Remaining,RateLimit-Reset,X-Quota-Limit,X-Quota-Remaining",
+			MaxAge:         10 * time.Minute,
+		},
+		Admission: Admission{
+			InitialLimit:  20,
+			MinLimit:      5,
+			MaxLimit:      100,
+			TargetLatency: 2 * time.Second,
+			QueueSize:     50,
+			QueueTimeout:  500 * time.Millisecond,
+		},
+	}
+}
+
+// Validate returns an error describing every invalid setting.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	_, _, err := net.SplitHostPort(c.Server.Addr)
+	check(err == nil, "server.addr: invalid address %q", c.Server.Addr)
+	check(c.Server.ReadHeaderTimeout > 0, "server.readHeaderTimeout: must be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdownTimeout: must be positive")
+	check(c.Server.DrainDelay >= 0, "server.drainDelay: must not be negative")
+	for _, p := range splitList(c.Server.TrustedProxies) {
+		_, _, err := net.ParseCIDR(p)
+		check(err == nil || net.ParseIP(p) != nil, "server.trustedProxies: invalid IP or CIDR %q", p)
+	}
+	check((c.Server.TLS.CertFile == "") == (c.Server.TLS.KeyFile == ""), "server.tls: certFile and keyFile must be set together")
+	check(c.Server.TLS.ClientCAFile == "" || c.Server.TLS.Enabled(), "server.tls.clientCAFile: requires certFile")
+	_, err = tlsconfig.ParseVersion(c.Server.TLS.MinVersion)
+	check(err == nil, "server.tls.minVersion: unsupported version %q", c.Server.TLS.MinVersion)
+	check(!c.Server.TLS.Enabled() || c.Server.TLS.ReloadInterval > 0, "server.tls.reloadInterval: must be positive")
+
+	check(c.Handler.Timeout > 0, "handler.timeout: must be positive")
+	check(c.Handler.Country != "", "handler.country: must not be empty")
+
+	check(validURL(c.Upstream.OpenStreetMapURL), "upstream.openStreetMapURL: invalid URL %q", c.Upstream.OpenStreetMapURL)
+	check(validURL(c.Upstream.WeatherGovURL), "upstream.weatherGovURL: invalid URL %q", c.Upstream.WeatherGovURL)
+	check(c.Upstream.Timeout > 0, "upstream.timeout: must be positive")
+
+	check(c.Cache.Backend == "memory" || c.Cache.Backend == "redis", "cache.backend: unknown backend %q", c.Cache.Backend)
+	check(c.Cache.TTL > 0, "cache.ttl: must be positive")
+	check(c.Cache.Capacity > 0, "cache.capacity: must be positive")
+	check(c.Cache.MaxBytes >= 0, "cache.maxBytes: must not be negative")
+	check(c.Cache.Grace >= 0, "cache.grace: must not be negative")
+	if c.Cache.Backend == "redis" {
+		check(c.Cache.Redis.Addr != "", "cache.redis.addr: must not be empty")
+		check(c.Cache.Redis.DB >= 0, "cache.redis.db: must not be negative")
+		check(c.Cache.Redis.PoolSize >= 0, "cache.redis.poolSize: must not be negative")
+		check(c.Cache.L1.Capacity >= 0, "cache.l1.capacity: must not be negative")
+		check(c.Cache.L1.Capacity == 0 || c.Cache.L1.TTL > 0, "cache.l1.ttl: must be positive")
+	}
+	if c.Cache.Snapshot.Path != "" {
+		check(c.Cache.Backend == "memory", "cache.snapshot.path: snapshots require the memory backend")
+		check(c.Cache.Snapshot.Interval > 0, "cache.snapshot.interval: must be positive")
+	}
+
+	check(c.Tracing.Exporter == "none" || c.Tracing.Exporter == "stdout" || c.Tracing.Exporter == "otlp",
+		"tracing.exporter: unknown exporter %q", c.Tracing.Exporter)
+
+	_, err = zapcore.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level: unknown level %q", c.Log.Level)
+
+	if jwt := &c.Auth.JWT; jwt.Enabled() {
+		check(jwt.JWKSURL == "" || jwt.KeyFile == "", "auth.jwt: jwksURL and keyFile are mutually exclusive")
+		check(jwt.JWKSURL == "" || validURL(jwt.JWKSURL), "auth.jwt.jwksURL: invalid URL %q", jwt.JWKSURL)
+		check(jwt.JWKSRefreshInterval > 0, "auth.jwt.jwksRefreshInterval: must be positive")
+		check(jwt.Issuer != "", "auth.jwt.issuer: must not be empty")
+		check(jwt.Audience != "", "auth.jwt.audience: must not be empty")
+		check(jwt.ReadScope != "", "auth.jwt.readScope: must not be empty")
+		check(jwt.AdminScope != "", "auth.jwt.adminScope: must not be empty")
+	}
+
+	if rl := &c.RateLimit; rl.Enabled {
+		check(rl.Period > 0, "rateLimit.period: must be positive")
+		check(rl.ConsumerRequests > 0, "rateLimit.consumerRequests: must be positive")
+		check(rl.ConsumerBurst > 0, "rateLimit.consumerBurst: must be positive")
+		check(rl.AnonymousRequests > 0, "rateLimit.anonymousRequests: must be positive")
+		check(rl.AnonymousBurst > 0, "rateLimit.anonymousBurst: must be positive")
+	}
+
+	check(c.Usage.Path == "" || c.Usage.SaveInterval > 0, "usage.saveInterval: must be positive")
+	check(c.Usage.Retention > 0, "usage.retention: must be positive")
+	check(c.Usage.MonthlyQuota >= 0, "usage.monthlyQuota: must not be negative")
+	check(c.Usage.QuotaMode == "warn" || c.Usage.QuotaMode == "block", "usage.quotaMode: unknown mode %q", c.Usage.QuotaMode)
+
+	if c.CORS.Enabled() {
+		_, err = cors.New(c.CORS.Policy())
+		check(err == nil, "cors: %v", err)
+		check(c.CORS.MaxAge >= 0, "cors.maxAge: must not be negative")
+	}
+
+	if a := &c.Admission; a.Enabled {
+		check(a.MinLimit > 0, "admission.minLimit: must be positive")
+		check(a.MaxLimit >= a.MinLimit, "admission.maxLimit: must not be less than minLimit")
+		check(a.InitialLimit >= a.MinLimit && a.InitialLimit <= a.MaxLimit, "admission.initialLimit: must be between minLimit and maxLimit")
+		check(a.TargetLatency > 0, "admission.targetLatency: must be positive")
+		check(a.QueueSize >= 0, "admission.queueSize: must not be negative")
+		check(a.QueueTimeout >= 0, "admission.queueTimeout: must not be negative")
+	}
+
+	return errors.Join(errs...)
+}
+
+// Changed returns the flags of the settings which differ between a and b.
+func Changed(a, b *Config) []string {
+	var changed []string
+	bs := settingsOf(b)
+	for i, s := range settingsOf(a) {
+		if !reflect.DeepEqual(s.field.Interface(), bs[i].field.Interface()) {
+			changed = append(changed, s.flag)
+		}
+	}
+	return changed
+}
+
+// splitList returns the elements of the comma separated list s.
+func splitList(s string) []string {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+// validURL reports whether s is an absolute http(s) URL.
+func validURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(k string) (string, bool) {
+		v, ok := vars[k]
+		return v, ok
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	t.Parallel()
+	path := writeFile(t, `
+server:
+  addr: ":9090"
+handler:
+  country: CAN
+cache:
+  backend: redis
+  ttl: 1h
+  redis:
+    addr: redis:6379
+`)
+
+	cfg, opts, err := Load("weather-service", []string{"-config", path, "-cache-ttl=2h", "-redis-db", "3"}, env(map[string]string{
+		"WEATHER_CACHE_TTL":  "30m",
+		"WEATHER_COUNTRY":    "MEX",
+		"WEATHER_REDIS_ADDR": "cache:6379",
+	}))
+	require.NoError(t, err)
+
+	assert.Equal(t, path, opts.Path)
+	// default
+	assert.Equal(t, 10*time.Second, cfg.Handler.Timeout)
+	// file over default
+	assert.Equal(t, ":9090", cfg.Server.Addr)
+	assert.Equal(t, "redis", cfg.Cache.Backend)
+	// env over file
+	assert.Equal(t, "MEX", cfg.Handler.Country)
+	assert.Equal(t, "cache:6379", cfg.Cache.Redis.Addr)
+	// flag over env and file
+	assert.Equal(t, 2*time.Hour, cfg.Cache.TTL)
+	assert.Equal(t, 3, cfg.Cache.Redis.DB)
+}
+
+func TestLoad_ConfigEnv(t *testing.T) {
+	t.Parallel()
+	path := writeFile(t, "upstream:\n  openStreetMapURL: http://nominatim.internal:8080/\n")
+
+	cfg, _, err := Load("weather-service", nil, env(map[string]string{"WEATHER_CONFIG": path}))
+	require.NoError(t, err)
+	assert.Equal(t, "http://nominatim.internal:8080/", cfg.Upstream.OpenStreetMapURL)
+}
+
+func TestLoad_Errors(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		file    string
+		args    []string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name:    "unknown flag",
+			args:    []string{"-cache-size=10"},
+			wantErr: "flag provided but not defined",
+		},
+		{
+			name:    "invalid flag",
+			args:    []string{"-cache-ttl=forever"},
+			wantErr: "parsing -cache-ttl",
+		},
+		{
+			name:    "invalid env",
+			env:     map[string]string{"WEATHER_CACHE_CAPACITY": "many"},
+			wantErr: "parsing WEATHER_CACHE_CAPACITY",
+		},
+		{
+			name:    "unknown file key",
+			file:    "cache:\n  size: 10\n",
+			wantErr: "field size not found",
+		},
+		{
+			name:    "invalid setting",
+			env:     map[string]string{"WEATHER_CACHE_BACKEND": "memcached"},
+			wantErr: `cache.backend: unknown backend "memcached"`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			args := tt.args
+			if tt.file != "" {
+				args = append(args, "-config", writeFile(t, tt.file))
+			}
+			_, _, err := Load("weather-service", args, env(tt.env))
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestLoad_PrintConfig(t *testing.T) {
+	t.Parallel()
+	// invalid settings are printed rather than rejected, so they can be inspected
+	cfg, opts, err := Load("weather-service", []string{"--print-config", "-cache-backend=memcached"}, env(nil))
+	require.NoError(t, err)
+	assert.True(t, opts.PrintConfig)
+
+	var out bytes.Buffer
+	require.NoError(t, Print(&out, cfg))
+	assert.Contains(t, out.String(), "backend: memcached")
+	assert.Contains(t, out.String(), "ttl: 5h0m0s")
+
+	// the printed config can be loaded back
+	path := writeFile(t, out.String())
+	loaded, _, err := Load("weather-service", []string{"-config", path, "-print-config"}, env(nil))
+	require.NoError(t, err)
+	assert.Equal(t, cfg, loaded)
+}
+
+func TestChanged(t *testing.T) {
+	t.Parallel()
+	a := Default()
+	b := Default()
+	assert.Empty(t, Changed(a, b))
+
+	b.Handler.Timeout = time.Second
+	b.Cache.Redis.Addr = "redis:6379"
+	b.Log.Level = "debug"
+	assert.Equal(t, []string{"request-timeout", "redis-addr", "log-level"}, Changed(a, b))
+}
+
+func TestConfig_Validate(t *testing.T) {
+	t.Parallel()
+	assert.NoError(t, Default().Validate())
+
+	cfg := Default()
+	cfg.Server.Addr = "8080"
+	cfg.Server.TrustedProxies = "10.0.0.0/8, proxy.internal"
+	cfg.Handler.Timeout = 0
+	cfg.Upstream.WeatherGovURL = "api.weather.gov"
+	cfg.Upstream.Timeout = 0
+	cfg.Cache.Snapshot.Path = "/var/lib/weather-service/cache"
+	cfg.Cache.Backend = "redis"
+	cfg.Cache.MaxBytes = -1
+	cfg.Log.Level = "verbose"
+	cfg.Server.TLS.KeyFile = "/etc/weather-service/tls.key"
+	cfg.Server.TLS.MinVersion = "1.0"
+	cfg.Auth.JWT.JWKSURL = "https://idp.example.com/.well-known/jwks.json"
+	cfg.Auth.JWT.KeyFile = "/etc/weather-service/jwks.json"
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.AnonymousBurst = 0
+	cfg.Usage.QuotaMode = "throttle"
+	cfg.CORS.AllowedOrigins = "https://dashboard.example.com, *"
+	cfg.CORS.AllowCredentials = true
+	cfg.Admission.Enabled = true
+	cfg.Admission.MaxLimit = 1
+	err := cfg.Validate()
+	assert.ErrorContains(t, err, "server.addr")
+	assert.ErrorContains(t, err, `server.trustedProxies: invalid IP or CIDR "proxy.internal"`)
+	assert.ErrorContains(t, err, "handler.timeout")
+	assert.ErrorContains(t, err, "upstream.weatherGovURL")
+	assert.ErrorContains(t, err, "upstream.timeout")
+	assert.ErrorContains(t, err, "snapshots require the memory backend")
+	assert.ErrorContains(t, err, "cache.maxBytes")
+	assert.ErrorContains(t, err, "log.level")
+	assert.ErrorContains(t, err, "certFile and keyFile must be set together")
+	assert.ErrorContains(t, err, "server.tls.minVersion")
+	assert.ErrorContains(t, err, "jwksURL and keyFile are mutually exclusive")
+	assert.ErrorContains(t, err, "auth.jwt.issuer")
+	assert.ErrorContains(t, err, "auth.jwt.audience")
+	assert.ErrorContains(t, err, "rateLimit.anonymousBurst")
+	assert.ErrorContains(t, err, `usage.quotaMode: unknown mode "throttle"`)
+	assert.ErrorContains(t, err, "cors: origin * cannot be allowed with credentials")
+	assert.ErrorContains(t, err, "admission.maxLimit")
+	assert.ErrorContains(t, err, "admission.initialLimit")
+}
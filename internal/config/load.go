@@ -0,0 +1,219 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// envPrefix prefixes the environment variables of the settings.
+	envPrefix = "WEATHER_"
+	// configEnv names the environment variable of the config file path.
+	configEnv = envPrefix + "CONFIG"
+)
+
+// Options are the command line options which are not settings.
+type Options struct {
+	// Path is the path of the config file, if any.
+	Path string
+	// PrintConfig reports whether to print the effective configuration and
+	// exit.
+	PrintConfig bool
+}
+
+// setting is a field of Config set from a flag, an environment variable or
+// the config file.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	field reflect.Value
+}
+
+// Load returns the configuration read from the given command line arguments,
+// without the program name, the environment as returned by lookupEnv and the
+// config file set with -config or WEATHER_CONFIG. The configuration is
+// validated unless -print-config is set, so that invalid settings can be
+// inspected.
+func Load(name string, args []string, lookupEnv func(string) (string, bool)) (*Config, *Options, error) {
+	cfg := Default()
+	settings := settingsOf(cfg)
+
+	// flags are parsed first, to find the config file, and applied last
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	opts := &Options{}
+	fs.StringVar(&opts.Path, "config", "", "Path of the YAML config file, also set with "+configEnv+".")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "Print the effective configuration and exit.")
+	flags := make(map[string]*flagValue, len(settings))
+	for _, s := range settings {
+		v := &flagValue{value: formatValue(s.field), isBool: s.field.Kind() == reflect.Bool}
+		flags[s.flag] = v
+		fs.Var(v, s.flag, fmt.Sprintf("%s Also set with %s.", s.usage, s.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if opts.Path == "" {
+		opts.Path, _ = lookupEnv(configEnv)
+	}
+	if opts.Path != "" {
+		if err := loadFile(cfg, opts.Path); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := lookupEnv(s.env); ok {
+			if err := parseValue(s.field, v); err != nil {
+				return nil, nil, fmt.Errorf("parsing %s: %w", s.env, err)
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if v := flags[s.flag]; v.set {
+			if err := parseValue(s.field, v.value); err != nil {
+				return nil, nil, fmt.Errorf("parsing -%s: %w", s.flag, err)
+			}
+		}
+	}
+
+	if !opts.PrintConfig {
+		if err := cfg.Validate(); err != nil {
+			return nil, nil, fmt.Errorf("invalid config: %w", err)
+		}
+	}
+	return cfg, opts, nil
+}
+
+// Print writes cfg to w as YAML, in the format of the config file.
+func Print(w io.Writer, cfg *Config) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// loadFile sets the settings present in the YAML file at path. Unknown keys
+// are rejected, so that typos do not go unnoticed.
+func loadFile(cfg *Config, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// settingsOf returns the settings of cfg, in declaration order.
+func settingsOf(cfg *Config) []setting {
+	var settings []setting
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.Type.Kind() == reflect.Struct {
+				walk(v.Field(i))
+				continue
+			}
+			name := f.Tag.Get("flag")
+			if name == "" {
+				continue
+			}
+			settings = append(settings, setting{
+				flag:  name,
+				env:   envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_")),
+				usage: f.Tag.Get("usage"),
+				field: v.Field(i),
+			})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem())
+	return settings
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// parseValue sets field to the value parsed from s.
+func parseValue(field reflect.Value, s string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(s)
+	case reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
+
+// formatValue returns the value of field in the format read by parseValue.
+func formatValue(field reflect.Value) string {
+	if field.Type() == durationType {
+		return time.Duration(field.Int()).String()
+	}
+	return fmt.Sprint(field.Interface())
+}
+
+// flagValue records the raw value of a flag, so that it is applied after the
+// config file and the environment.
+type flagValue struct {
+	value  string
+	set    bool
+	isBool bool
+}
+
+func (v *flagValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.value
+}
+
+func (v *flagValue) Set(s string) error {
+	v.value = s
+	v.set = true
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	return v.isBool
+}
@@ -0,0 +1,211 @@
+// Package cors implements Cross-Origin Resource Sharing, so that browser
+// clients served from other origins can call the API.
+package cors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Config is the CORS policy of a route group.
+type Config struct {
+	// AllowedOrigins are the origins allowed to call the routes, e.g.
+	// https://dashboard.example.com. An origin can start with a wildcard
+	// subdomain, e.g. https://*.example.com, and * allows every origin.
+	AllowedOrigins []string
+	// AllowedMethods are the methods allowed to cross-origin requests.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed to cross-origin
+	// requests, in addition to the CORS-safelisted ones.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers exposed to browser clients, in
+	// addition to the CORS-safelisted ones.
+	ExposedHeaders []string
+	// AllowCredentials allows cross-origin requests to carry cookies and
+	// authorization headers.
+	AllowCredentials bool
+	// MaxAge is the duration browsers cache the result of preflight requests.
+	MaxAge time.Duration
+}
+
+// Policy enforces a CORS config.
+type Policy struct {
+	allowAll bool
+	origins  map[string]bool
+	// suffixes are the scheme and domain of wildcard origins, e.g.
+	// https:// and .example.com for https://*.example.com.
+	suffixes [][2]string
+
+	methods map[string]bool
+	headers map[string]bool
+
+	allowMethods     string
+	exposeHeaders    string
+	allowCredentials bool
+	maxAge           string
+}
+
+// New creates a new Policy enforcing cfg.
+func New(cfg *Config) (*Policy, error) {
+	p := &Policy{
+		origins:          make(map[string]bool),
+		methods:          make(map[string]bool),
+		headers:          make(map[string]bool),
+		allowMethods:     strings.Join(cfg.AllowedMethods, ", "),
+		exposeHeaders:    strings.Join(cfg.ExposedHeaders, ", "),
+		allowCredentials: cfg.AllowCredentials,
+		maxAge:           strconv.Itoa(int(cfg.MaxAge.Seconds())),
+	}
+
+	if len(cfg.AllowedOrigins) == 0 {
+		return nil, errors.New("no allowed origins")
+	}
+	for _, o := range cfg.AllowedOrigins {
+		if o == "*" {
+			if cfg.AllowCredentials {
+				return nil, errors.New("origin * cannot be allowed with credentials")
+			}
+			p.allowAll = true
+			continue
+		}
+		u, err := url.Parse(o)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return nil, fmt.Errorf("invalid origin %q", o)
+		}
+		scheme, host := u.Scheme+"://", strings.ToLower(u.Host)
+		if domain, found := strings.CutPrefix(host, "*."); found {
+			if domain == "" || strings.Contains(domain, "*") {
+				return nil, fmt.Errorf("invalid origin %q", o)
+			}
+			p.suffixes = append(p.suffixes, [2]string{scheme, "." + domain})
+			continue
+		}
+		if strings.Contains(host, "*") {
+			return nil, fmt.Errorf("invalid origin %q: wildcards are only allowed as subdomains", o)
+		}
+		p.origins[scheme+host] = true
+	}
+	for _, m := range cfg.AllowedMethods {
+		p.methods[strings.ToUpper(m)] = true
+	}
+	for _, h := range cfg.AllowedHeaders {
+		p.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	return p, nil
+}
+
+// Register enforces p on the routes of r, and answers the preflight requests
+// of every route of r. It must be called before the other middlewares of r
+// are added, e.g. authentication, so that preflight requests, which carry no
+// credentials, are answered first.
+func (p *Policy) Register(r *gin.RouterGroup) {
+	r.Use(p.Middleware())
+	// preflight requests are answered by the middleware, but are only routed
+	// to it on matching routes
+	r.OPTIONS("/*path", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+}
+
+// Middleware returns a gin middleware answering preflight requests and adding
+// the CORS headers to the responses to allowed origins.
+func (p *Policy) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		c.Writer.Header().Add("Vary", "Origin")
+
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if preflight {
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+		if !p.allowsOrigin(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			// the browser blocks the response without CORS headers
+			c.Next()
+			return
+		}
+
+		if preflight {
+			p.preflight(c, origin)
+			return
+		}
+		p.setOrigin(c, origin)
+		if p.exposeHeaders != "" {
+			c.Header("Access-Control-Expose-Headers", p.exposeHeaders)
+		}
+		c.Next()
+	}
+}
+
+// preflight answers the preflight request of c from origin.
+func (p *Policy) preflight(c *gin.Context, origin string) {
+	if !p.methods[strings.ToUpper(c.GetHeader("Access-Control-Request-Method"))] {
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	var headers []string
+	for _, h := range strings.Split(c.GetHeader("Access-Control-Request-Headers"), ",") {
+		h = http.CanonicalHeaderKey(strings.TrimSpace(h))
+		if h == "" {
+			continue
+		}
+		if !p.headers[h] {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		headers = append(headers, h)
+	}
+
+	p.setOrigin(c, origin)
+	c.Header("Access-Control-Allow-Methods", p.allowMethods)
+	if len(headers) > 0 {
+		c.Header("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	}
+	c.Header("Access-Control-Max-Age", p.maxAge)
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+// setOrigin allows origin to read the response of c.
+func (p *Policy) setOrigin(c *gin.Context, origin string) {
+	if p.allowAll {
+		c.Header("Access-Control-Allow-Origin", "*")
+		return
+	}
+	c.Header("Access-Control-Allow-Origin", origin)
+	if p.allowCredentials {
+		c.Header("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// allowsOrigin reports whether origin is allowed.
+func (p *Policy) allowsOrigin(origin string) bool {
+	if p.allowAll {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	for _, s := range p.suffixes {
+		host, found := strings.CutPrefix(origin, s[0])
+		if found && len(host) > len(s[1]) && strings.HasSuffix(host, s[1]) && !strings.Contains(host, "/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,249 @@
+package cors_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cityhunteur/weather-service/internal/cors"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		origins     []string
+		credentials bool
+		wantErr     string
+	}{
+		{name: "origins", origins: []string{"https://dashboard.example.com", "http://localhost:3000", "https://*.example.org"}},
+		{name: "any origin", origins: []string{"*"}},
+		{name: "no origins", wantErr: "no allowed origins"},
+		{name: "any origin with credentials", origins: []string{"*"}, credentials: true, wantErr: "cannot be allowed with credentials"},
+		{name: "missing scheme", origins: []string{"dashboard.example.com"}, wantErr: "invalid origin"},
+		{name: "path", origins: []string{"https://example.com/dashboard"}, wantErr: "invalid origin"},
+		{name: "inner wildcard", origins: []string{"https://dashboard.*.example.com"}, wantErr: "only allowed as subdomains"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := cors.New(&cors.Config{AllowedOrigins: tt.origins, AllowCredentials: tt.credentials})
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPolicy_Register(t *testing.T) {
+	t.Parallel()
+	policy, err := cors.New(&cors.Config{
+		AllowedOrigins:   []string{"https://dashboard.example.com", "https://*.example.org"},
+		AllowedMethods:   []string{"GET", "HEAD"},
+		AllowedHeaders:   []string{"Authorization", "X-API-Key"},
+		ExposedHeaders:   []string{"X-Request-ID", "Retry-After"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	require.NoError(t, err)
+
+	// /v1 is served to browsers, and requires credentials; /admin is not
+	requireKey := func(c *gin.Context) {
+		if c.GetHeader("X-API-Key") == "" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+		}
+	}
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router := gin.New()
+	api := router.Group("/v1")
+	policy.Register(api)
+	api.Use(requireKey)
+	api.GET("/weather", ok)
+	router.Group("/admin", requireKey).GET("/cache/stats", ok)
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		header         http.Header
+		wantStatusCode int
+		wantHeader     http.Header
+	}{
+		{
+			name:           "same origin",
+			method:         http.MethodGet,
+			target:         "/v1/weather",
+			header:         http.Header{"X-Api-Key": {"secret"}},
+			wantStatusCode: http.StatusOK,
+			wantHeader:     http.Header{},
+		},
+		{
+			name:           "allowed origin",
+			method:         http.MethodGet,
+			target:         "/v1/weather",
+			header:         http.Header{"Origin": {"https://dashboard.example.com"}, "X-Api-Key": {"secret"}},
+			wantStatusCode: http.StatusOK,
+			wantHeader: http.Header{
+				"Access-Control-Allow-Origin":      {"https://dashboard.example.com"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Expose-Headers":    {"X-Request-ID, Retry-After"},
+				"Vary":                             {"Origin"},
+			},
+		},
+		{
+			name:           "allowed origin without credentials",
+			method:         http.MethodGet,
+			target:         "/v1/weather",
+			header:         http.Header{"Origin": {"https://dashboard.example.com"}},
+			wantStatusCode: http.StatusUnauthorized,
+			wantHeader: http.Header{
+				"Access-Control-Allow-Origin":      {"https://dashboard.example.com"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Expose-Headers":    {"X-Request-ID, Retry-After"},
+				"Vary":                             {"Origin"},
+			},
+		},
+		{
+			name:           "wildcard subdomain",
+			method:         http.MethodGet,
+			target:         "/v1/weather",
+			header:         http.Header{"Origin": {"https://ops.staging.example.org"}, "X-Api-Key": {"secret"}},
+			wantStatusCode: http.StatusOK,
+			wantHeader: http.Header{
+				"Access-Control-Allow-Origin":      {"https://ops.staging.example.org"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Expose-Headers":    {"X-Request-ID, Retry-After"},
+				"Vary":                             {"Origin"},
+			},
+		},
+		{
+			name:           "wildcard subdomain does not match the domain",
+			method:         http.MethodGet,
+			target:         "/v1/weather",
+			header:         http.Header{"Origin": {"https://example.org"}, "X-Api-Key": {"secret"}},
+			wantStatusCode: http.StatusOK,
+			wantHeader:     http.Header{"Vary": {"Origin"}},
+		},
+		{
+			name:           "other origin",
+			method:         http.MethodGet,
+			target:         "/v1/weather",
+			header:         http.Header{"Origin": {"https://evil.example.com"}, "X-Api-Key": {"secret"}},
+			wantStatusCode: http.StatusOK,
+			wantHeader:     http.Header{"Vary": {"Origin"}},
+		},
+		{
+			name:   "preflight",
+			method: http.MethodOptions,
+			target: "/v1/weather",
+			header: http.Header{
+				"Origin":                         {"https://dashboard.example.com"},
+				"Access-Control-Request-Method":  {"GET"},
+				"Access-Control-Request-Headers": {"x-api-key"},
+			},
+			wantStatusCode: http.StatusNoContent,
+			wantHeader: http.Header{
+				"Access-Control-Allow-Origin":      {"https://dashboard.example.com"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Allow-Methods":     {"GET, HEAD"},
+				"Access-Control-Allow-Headers":     {"X-Api-Key"},
+				"Access-Control-Max-Age":           {"600"},
+				"Vary":                             {"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+			},
+		},
+		{
+			name:   "preflight of other origin",
+			method: http.MethodOptions,
+			target: "/v1/weather",
+			header: http.Header{
+				"Origin":                        {"https://evil.example.com"},
+				"Access-Control-Request-Method": {"GET"},
+			},
+			wantStatusCode: http.StatusForbidden,
+			wantHeader:     http.Header{"Vary": {"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}},
+		},
+		{
+			name:   "preflight of other method",
+			method: http.MethodOptions,
+			target: "/v1/weather",
+			header: http.Header{
+				"Origin":                        {"https://dashboard.example.com"},
+				"Access-Control-Request-Method": {"DELETE"},
+			},
+			wantStatusCode: http.StatusForbidden,
+			wantHeader:     http.Header{"Vary": {"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}},
+		},
+		{
+			name:   "preflight of other header",
+			method: http.MethodOptions,
+			target: "/v1/weather",
+			header: http.Header{
+				"Origin":                         {"https://dashboard.example.com"},
+				"Access-Control-Request-Method":  {"GET"},
+				"Access-Control-Request-Headers": {"X-API-Key, X-Debug"},
+			},
+			wantStatusCode: http.StatusForbidden,
+			wantHeader:     http.Header{"Vary": {"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}},
+		},
+		{
+			name:   "preflight of group without CORS",
+			method: http.MethodOptions,
+			target: "/admin/cache/stats",
+			header: http.Header{
+				"Origin":                        {"https://dashboard.example.com"},
+				"Access-Control-Request-Method": {"GET"},
+			},
+			wantStatusCode: http.StatusNotFound,
+			wantHeader:     http.Header{"Content-Type": {"text/plain"}},
+		},
+		{
+			name:           "group without CORS",
+			method:         http.MethodGet,
+			target:         "/admin/cache/stats",
+			header:         http.Header{"Origin": {"https://dashboard.example.com"}, "X-Api-Key": {"secret"}},
+			wantStatusCode: http.StatusOK,
+			wantHeader:     http.Header{},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			resp := httptest.NewRecorder()
+			req, _ := http.NewRequestWithContext(context.Background(), tt.method, tt.target, nil)
+			req.Header = tt.header
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.wantStatusCode, resp.Code)
+			assert.Equal(t, tt.wantHeader, resp.Header())
+		})
+	}
+}
+
+func TestPolicy_AnyOrigin(t *testing.T) {
+	t.Parallel()
+	policy, err := cors.New(&cors.Config{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}})
+	require.NoError(t, err)
+
+	resp := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(resp)
+	api := router.Group("/v1")
+	policy.Register(api)
+	api.GET("/weather", func(c *gin.Context) { c.Status(http.StatusOK) })
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/v1/weather", nil)
+	req.Header.Set("Origin", "https://anywhere.example.net")
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "*", resp.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, resp.Header().Get("Access-Control-Allow-Credentials"))
+}
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	v1 "github.com/cityhunteur/weather-service/api/v1"
+	"github.com/cityhunteur/weather-service/internal/cache"
+	"github.com/cityhunteur/weather-service/internal/logging"
+)
+
+// CacheAdmin is implemented by forecast caches which can be inspected and
+// purged by operators.
+//
+//go:generate mockery --name CacheAdmin
+type CacheAdmin interface {
+	Entries(ctx context.Context) ([]cache.ForecastEntry, error)
+	Peek(ctx context.Context, k string) (*cache.ForecastEntry, error)
+	Delete(ctx context.Context, k string) (bool, error)
+	Purge(ctx context.Context, prefix string) (int, error)
+	Flush(ctx context.Context) (int, error)
+	Stats() cache.Stats
+}
+
+// CacheAdminHandler serves the API used by operators to manage the forecast
+// cache.
+type CacheAdminHandler struct {
+	logger *zap.SugaredLogger
+
+	cache CacheAdmin
+}
+
+// NewCacheAdminHandler creates an API handler to manage the forecast cache.
+func NewCacheAdminHandler(logger *zap.SugaredLogger, cache CacheAdmin) *CacheAdminHandler {
+	return &CacheAdminHandler{
+		logger: logger,
+		cache:  cache,
+	}
+}
+
+// RegisterRoutes registers the cache administration routes on r.
+func (h *CacheAdminHandler) RegisterRoutes(r gin.IRoutes) {
+	r.GET("/cache/stats", h.GetStats)
+	r.GET("/cache/entries", h.ListEntries)
+	r.DELETE("/cache/entries", h.PurgeEntries)
+	r.GET("/cache/entries/*key", h.GetEntry)
+	r.DELETE("/cache/entries/*key", h.DeleteEntry)
+	r.DELETE("/cache", h.Flush)
+}
+
+// ListEntries lists the cache entries, optionally restricted to the keys
+// starting with the 'prefix' query param.
+func (h *CacheAdminHandler) ListEntries(c *gin.Context) {
+	entries, err := h.entries(c, c.Query("prefix"))
+	if err != nil {
+		h.log(c).Errorw("Failed to list cache entries", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to list cache entries"})
+		return
+	}
+
+	now := time.Now()
+	resp := &v1.ListCacheEntriesResponse{
+		Entries: make([]*v1.CacheEntry, 0, len(entries)),
+	}
+	for i := range entries {
+		resp.Entries = append(resp.Entries, toCacheEntry(&entries[i], now))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetEntry returns the cache entry with the key given in the path, including
+// its forecast.
+func (h *CacheAdminHandler) GetEntry(c *gin.Context) {
+	k := strings.TrimPrefix(c.Param("key"), "/")
+	e, err := h.cache.Peek(c, k)
+	if err != nil {
+		h.log(c).Errorw("Failed to retrieve cache entry", "error", err, "key", k)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to retrieve cache entry"})
+		return
+	}
+	if e == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Cache entry not found."})
+		return
+	}
+	c.JSON(http.StatusOK, toCacheEntry(e, time.Now()))
+}
+
+// DeleteEntry removes the cache entry with the key given in the path.
+func (h *CacheAdminHandler) DeleteEntry(c *gin.Context) {
+	k := strings.TrimPrefix(c.Param("key"), "/")
+	deleted, err := h.cache.Delete(c, k)
+	if err != nil {
+		h.log(c).Errorw("Failed to delete cache entry", "error", err, "key", k)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to delete cache entry"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Cache entry not found."})
+		return
+	}
+	h.log(c).Infow("Purged cache entry", "key", k)
+	c.JSON(http.StatusOK, &v1.PurgeCacheResponse{Purged: 1})
+}
+
+// PurgeEntries removes the cache entries with keys starting with the
+// 'prefix' query param.
+func (h *CacheAdminHandler) PurgeEntries(c *gin.Context) {
+	prefix := c.Query("prefix")
+	if prefix == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Query param 'prefix' missing."})
+		return
+	}
+
+	purged, err := h.cache.Purge(c, prefix)
+	if err != nil {
+		h.log(c).Errorw("Failed to purge cache entries", "error", err, "prefix", prefix, "purged", purged)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to purge cache entries"})
+		return
+	}
+	h.log(c).Infow("Purged cache entries", "prefix", prefix, "purged", purged)
+	c.JSON(http.StatusOK, &v1.PurgeCacheResponse{Purged: purged})
+}
+
+// Flush removes all cache entries.
+func (h *CacheAdminHandler) Flush(c *gin.Context) {
+	purged, err := h.cache.Flush(c)
+	if err != nil {
+		h.log(c).Errorw("Failed to flush cache", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to flush cache"})
+		return
+	}
+	h.log(c).Infow("Flushed cache", "purged", purged)
+	c.JSON(http.StatusOK, &v1.PurgeCacheResponse{Purged: purged})
+}
+
+// GetStats returns the counters of the cache.
+func (h *CacheAdminHandler) GetStats(c *gin.Context) {
+	stats := h.cache.Stats()
+	c.JSON(http.StatusOK, &v1.CacheStats{
+		Hits:        stats.Hits,
+		Misses:      stats.Misses,
+		Evictions:   stats.Evictions,
+		Expirations: stats.Expirations,
+		Entries:     stats.Entries,
+		Bytes:       stats.Bytes,
+	})
+}
+
+// entries returns the cache entries with keys starting with prefix.
+func (h *CacheAdminHandler) entries(ctx context.Context, prefix string) ([]cache.ForecastEntry, error) {
+	entries, err := h.cache.Entries(ctx)
+	if err != nil || prefix == "" {
+		return entries, err
+	}
+	matching := entries[:0]
+	for _, e := range entries {
+		if strings.HasPrefix(e.Key, prefix) {
+			matching = append(matching, e)
+		}
+	}
+	return matching, nil
+}
+
+// log returns the logger of the request, or the logger of the handler.
+func (h *CacheAdminHandler) log(c *gin.Context) *zap.SugaredLogger {
+	return logging.FromContext(c.Request.Context(), h.logger)
+}
+
+func toCacheEntry(e *cache.ForecastEntry, now time.Time) *v1.CacheEntry {
+	return &v1.CacheEntry{
+		Key:       e.Key,
+		StoredAt:  v1.Time3339(e.StoredAt),
+		ExpiresAt: v1.Time3339(e.ExpiresAt),
+		Age:       int64(now.Sub(e.StoredAt).Seconds()),
+		TTL:       int64(e.ExpiresAt.Sub(now).Seconds()),
+		Forecast:  e.Value,
+	}
+}
@@ -0,0 +1,165 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+
+	v1 "github.com/cityhunteur/weather-service/api/v1"
+	"github.com/cityhunteur/weather-service/internal/auth"
+	"github.com/cityhunteur/weather-service/internal/cache"
+	"github.com/cityhunteur/weather-service/internal/handler"
+)
+
+func TestCacheAdminHandler(t *testing.T) {
+	t.Parallel()
+	const token = "s3cr3t"
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		token          string
+		wantStatusCode int
+		wantBody       any
+		wantKeys       []string
+	}{
+		{
+			name:           "unauthorized",
+			method:         http.MethodGet,
+			target:         "/admin/cache/stats",
+			token:          "invalid",
+			wantStatusCode: http.StatusUnauthorized,
+			wantKeys:       []string{"OKX/33,35", "OKX/34,36", "LOX/154,44"},
+		},
+		{
+			name:           "list entries by prefix",
+			method:         http.MethodGet,
+			target:         "/admin/cache/entries?prefix=OKX/",
+			token:          token,
+			wantStatusCode: http.StatusOK,
+			wantBody:       &v1.ListCacheEntriesResponse{},
+			wantKeys:       []string{"OKX/33,35", "OKX/34,36", "LOX/154,44"},
+		},
+		{
+			name:           "get entry",
+			method:         http.MethodGet,
+			target:         "/admin/cache/entries/OKX/33,35",
+			token:          token,
+			wantStatusCode: http.StatusOK,
+			wantBody:       &v1.CacheEntry{},
+			wantKeys:       []string{"OKX/33,35", "OKX/34,36", "LOX/154,44"},
+		},
+		{
+			name:           "get missing entry",
+			method:         http.MethodGet,
+			target:         "/admin/cache/entries/LOT/76,73",
+			token:          token,
+			wantStatusCode: http.StatusNotFound,
+			wantKeys:       []string{"OKX/33,35", "OKX/34,36", "LOX/154,44"},
+		},
+		{
+			name:           "delete entry",
+			method:         http.MethodDelete,
+			target:         "/admin/cache/entries/OKX/33,35",
+			token:          token,
+			wantStatusCode: http.StatusOK,
+			wantBody:       &v1.PurgeCacheResponse{Purged: 1},
+			wantKeys:       []string{"OKX/34,36", "LOX/154,44"},
+		},
+		{
+			name:           "purge by prefix",
+			method:         http.MethodDelete,
+			target:         "/admin/cache/entries?prefix=OKX/",
+			token:          token,
+			wantStatusCode: http.StatusOK,
+			wantBody:       &v1.PurgeCacheResponse{Purged: 2},
+			wantKeys:       []string{"LOX/154,44"},
+		},
+		{
+			name:           "purge without prefix",
+			method:         http.MethodDelete,
+			target:         "/admin/cache/entries",
+			token:          token,
+			wantStatusCode: http.StatusBadRequest,
+			wantKeys:       []string{"OKX/33,35", "OKX/34,36", "LOX/154,44"},
+		},
+		{
+			name:           "flush",
+			method:         http.MethodDelete,
+			target:         "/admin/cache",
+			token:          token,
+			wantStatusCode: http.StatusOK,
+			wantBody:       &v1.PurgeCacheResponse{Purged: 3},
+			wantKeys:       []string{},
+		},
+		{
+			name:           "stats",
+			method:         http.MethodGet,
+			target:         "/admin/cache/stats",
+			token:          token,
+			wantStatusCode: http.StatusOK,
+			wantBody:       &v1.CacheStats{Entries: 3},
+			wantKeys:       []string{"OKX/33,35", "OKX/34,36", "LOX/154,44"},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			store := cache.NewStore[string, *v1.Forecast](cache.WithTTL(time.Hour))
+			for _, k := range []string{"LOX/154,44", "OKX/34,36", "OKX/33,35"} {
+				store.Set(k, &v1.Forecast{Name: k}, 0)
+			}
+			logger := zaptest.NewLogger(t).Sugar()
+			h := handler.NewCacheAdminHandler(logger, store)
+
+			resp := httptest.NewRecorder()
+			_, router := gin.CreateTestContext(resp)
+			h.RegisterRoutes(router.Group("/admin", auth.AuthenticateToken(token, logger), auth.Required()))
+			req, _ := http.NewRequestWithContext(context.Background(), tt.method, tt.target, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.wantStatusCode, resp.Code)
+			switch want := tt.wantBody.(type) {
+			case *v1.ListCacheEntriesResponse:
+				var got v1.ListCacheEntriesResponse
+				assert.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+				assert.Len(t, got.Entries, 2)
+				for _, e := range got.Entries {
+					assert.Contains(t, e.Key, "OKX/")
+					assert.InDelta(t, 3600, e.TTL, 5)
+					assert.Nil(t, e.Forecast)
+				}
+			case *v1.CacheEntry:
+				var got v1.CacheEntry
+				assert.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+				assert.Equal(t, "OKX/33,35", got.Key)
+				assert.Equal(t, "OKX/33,35", got.Forecast.Name)
+			case *v1.PurgeCacheResponse:
+				var got v1.PurgeCacheResponse
+				assert.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+				assert.Equal(t, want, &got)
+			case *v1.CacheStats:
+				var got v1.CacheStats
+				assert.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+				assert.Equal(t, want.Entries, got.Entries)
+			}
+
+			entries, err := store.Entries(context.Background())
+			assert.NoError(t, err)
+			keys := make([]string, 0, len(entries))
+			for _, e := range entries {
+				keys = append(keys, e.Key)
+			}
+			assert.Equal(t, tt.wantKeys, keys)
+		})
+	}
+}
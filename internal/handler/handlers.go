@@ -2,28 +2,65 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 
 	v1 "github.com/cityhunteur/weather-service/api/v1"
+	"github.com/cityhunteur/weather-service/internal/cache"
+	"github.com/cityhunteur/weather-service/internal/logging"
 	"github.com/cityhunteur/weather-service/internal/pkg/openstreetmap"
 	"github.com/cityhunteur/weather-service/internal/pkg/weathergov"
+	"github.com/cityhunteur/weather-service/internal/usage"
 )
 
+// Defaults of the handlers created without WithTimeout or WithCountry, which
+// are also the defaults of the configuration of the service.
 const (
-	defaultTimeout = 10 * time.Second
-	defaultFormat  = "json"
+	DefaultTimeout = 10 * time.Second
+	DefaultCountry = "USA"
+)
+
+const (
+	defaultFormat = "json"
+
+	// minForecastTTL is the TTL of forecasts upstream advertises as expiring
+	// sooner, e.g. already expired because of clock skew, so that they are
+	// still cached and served stale within the grace window.
+	minForecastTTL = time.Minute
+
+	// retryAfterShed is the Retry-After of shed requests, in seconds.
+	retryAfterShed = "1"
+
+	// timeoutHeader carries the maximum duration of a request asked by the
+	// client.
+	timeoutHeader = "X-Request-Timeout"
 
-	defaultCountry = "USA"
+	tracerName = "github.com/cityhunteur/weather-service/internal/handler"
 )
 
+// errPlaceNotFound is returned when no place matches a search query, so that
+// the absence of a place is not cached.
+var errPlaceNotFound = errors.New("place not found")
+
+// errShed is returned when a request needing upstream calls is not admitted.
+var errShed = errors.New("request shed")
+
 //go:generate mockery --name OpenStreetMapAPI
 type OpenStreetMapAPI interface {
 	GetPlace(ctx context.Context, opts *openstreetmap.GetOptions) ([]*openstreetmap.Place, error)
@@ -35,10 +72,49 @@ type WeatherGovAPI interface {
 	GetForecast(ctx context.Context, forecastURL string) (*weathergov.Forecast, error)
 }
 
+// Cache caches forecasts by city. A ttl of zero passed to Set stores the
+// forecast using the TTL configured for the cache. Lookup returns forecasts,
+// including expired ones still within the grace window of the cache, along
+// with the time they were stored and whether they are still fresh.
+//
 //go:generate mockery --name Cache
 type Cache interface {
-	Set(k string, v *v1.Forecast)
-	Get(k string) (*v1.Forecast, bool)
+	Set(k string, v *v1.Forecast, ttl time.Duration)
+	Lookup(k string) (v *v1.Forecast, storedAt time.Time, fresh, found bool)
+}
+
+// PlaceCache caches the place resolved for a search query, loading it on
+// a miss. A load shared by concurrent requests is given the context of the
+// first one, whose consumer is charged for its upstream calls.
+//
+//go:generate mockery --name PlaceCache
+type PlaceCache interface {
+	GetOrLoad(ctx context.Context, k string, fn cache.LoadFunc[*openstreetmap.Place]) (*openstreetmap.Place, error)
+}
+
+// PointsCache caches the points metadata of a geolocation, loading it on a
+// miss, like PlaceCache.
+//
+//go:generate mockery --name PointsCache
+type PointsCache interface {
+	GetOrLoad(ctx context.Context, k string, fn cache.LoadFunc[*weathergov.Points]) (*weathergov.Points, error)
+}
+
+// AliasCache caches the canonical key a normalized city name resolves to.
+//
+//go:generate mockery --name AliasCache
+type AliasCache interface {
+	Set(k string, v string, ttl time.Duration)
+	Get(k string) (string, bool)
+}
+
+// Admission bounds the number of requests calling upstream APIs concurrently.
+// Acquire returns the function to call once the request completes, or an
+// error if the request is not admitted.
+//
+//go:generate mockery --name Admission
+type Admission interface {
+	Acquire(ctx context.Context) (func(), error)
 }
 
 type GetForecastHandler struct {
@@ -47,22 +123,120 @@ type GetForecastHandler struct {
 	openStreetMapAPI OpenStreetMapAPI
 	weatherGovAPI    WeatherGovAPI
 
-	cache Cache
+	cache       Cache
+	aliasCache  AliasCache
+	placeCache  PlaceCache
+	pointsCache PointsCache
+
+	admission Admission
+
+	tracer trace.Tracer
+
+	// timeout bounds the duration of a request, in nanoseconds, and can be
+	// changed while serving. country is the country cities are searched in.
+	timeout atomic.Int64
+	country string
+
+	// refreshing holds the keys whose stale forecast is being refreshed.
+	refreshing map[string]struct{}
+	refreshes  sync.WaitGroup
+	mu         sync.Mutex
+}
+
+// Option configures a GetForecastHandler.
+type Option func(h *GetForecastHandler)
+
+// WithAliasCache configures the handler to cache the canonical key each
+// spelling of a city resolves to.
+func WithAliasCache(c AliasCache) Option {
+	return func(h *GetForecastHandler) {
+		h.aliasCache = c
+	}
+}
+
+// WithPlaceCache configures the handler to cache the places resolved for a
+// city.
+func WithPlaceCache(c PlaceCache) Option {
+	return func(h *GetForecastHandler) {
+		h.placeCache = c
+	}
+}
+
+// WithPointsCache configures the handler to cache the points metadata of a
+// place.
+func WithPointsCache(c PointsCache) Option {
+	return func(h *GetForecastHandler) {
+		h.pointsCache = c
+	}
+}
+
+// WithAdmission configures the handler to only call upstream APIs for the
+// requests admitted by a, while still serving cached forecasts to the others.
+func WithAdmission(a Admission) Option {
+	return func(h *GetForecastHandler) {
+		h.admission = a
+	}
+}
+
+// WithTimeout configures the maximum duration of a request.
+func WithTimeout(d time.Duration) Option {
+	return func(h *GetForecastHandler) {
+		h.timeout.Store(int64(d))
+	}
+}
+
+// WithCountry configures the country cities are searched in.
+func WithCountry(country string) Option {
+	return func(h *GetForecastHandler) {
+		h.country = country
+	}
+}
+
+// WithTracerProvider configures the handler to create spans with the given
+// provider instead of the global one.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(h *GetForecastHandler) {
+		h.tracer = tp.Tracer(tracerName)
+	}
 }
 
 // NewGetForecastHandler creates an API handler to get weather forecast.
-func NewGetForecastHandler(logger *zap.SugaredLogger, openStreetMapAPI OpenStreetMapAPI, weatherGovAPI WeatherGovAPI, cache Cache) *GetForecastHandler {
-	return &GetForecastHandler{
+func NewGetForecastHandler(logger *zap.SugaredLogger, openStreetMapAPI OpenStreetMapAPI, weatherGovAPI WeatherGovAPI, cache Cache, opts ...Option) *GetForecastHandler {
+	h := &GetForecastHandler{
 		logger:           logger,
 		openStreetMapAPI: openStreetMapAPI,
 		weatherGovAPI:    weatherGovAPI,
 		cache:            cache,
+		refreshing:       make(map[string]struct{}),
+		tracer:           otel.Tracer(tracerName),
+		country:          DefaultCountry,
 	}
+	h.timeout.Store(int64(DefaultTimeout))
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// SetTimeout changes the maximum duration of the requests received from now
+// on.
+func (h *GetForecastHandler) SetTimeout(d time.Duration) {
+	h.timeout.Store(int64(d))
 }
 
 func (h *GetForecastHandler) GetForecast(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(c, defaultTimeout)
+	timeout, ok := h.requestTimeout(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Header '" + timeoutHeader + "' or query param 'timeout' invalid."})
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
 	defer cancel()
+	if h.admission != nil {
+		t := &ticket{admission: h.admission}
+		defer t.release()
+		ctx = context.WithValue(ctx, ticketKey{}, t)
+	}
 
 	citiesStr := c.DefaultQuery("city", "")
 	if citiesStr == "" {
@@ -70,88 +244,498 @@ func (h *GetForecastHandler) GetForecast(c *gin.Context) {
 		return
 	}
 
-	h.logger.Debugw("Getting forecasts", "cities", citiesStr)
+	h.log(ctx).Debugw("Getting forecasts", "cities", citiesStr, "timeout", timeout)
 
 	cities := strings.Split(citiesStr, ",")
+	usage.FromContext(ctx).AddCities(len(cities))
+
+	forecasts, err := h.getForecasts(ctx, cities)
+	if errors.Is(err, errShed) {
+		c.Header("Retry-After", retryAfterShed)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Service overloaded, retry later."})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to retrieve weather forecast"})
+		return
+	}
 
-	forecasts := make([]*v1.Forecast, 0)
-	for _, city := range cities {
-		h.logger.Debugw("Getting forecast for city", "city", city)
+	c.JSON(http.StatusOK, &v1.ListWeatherResponse{
+		Forecast: forecasts,
+	})
+}
 
-		// use value from cache if present
-		if forecast, exists := h.cache.Get(city); exists {
-			forecasts = append(forecasts, forecast)
+// requestTimeout returns the maximum duration of the request in c: the
+// timeout asked by the client in the X-Request-Timeout header or the timeout
+// query param, as a duration, e.g. 1500ms, or a number of seconds, capped by
+// the timeout of the handler. It reports false if the asked timeout is
+// invalid.
+func (h *GetForecastHandler) requestTimeout(c *gin.Context) (time.Duration, bool) {
+	maxTimeout := time.Duration(h.timeout.Load())
+	s := c.GetHeader(timeoutHeader)
+	if s == "" {
+		s = c.Query("timeout")
+	}
+	if s == "" {
+		return maxTimeout, true
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		secs, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsNaN(secs) || secs <= 0 {
+			return 0, false
+		}
+		// compared before converting, as large values overflow durations
+		if secs >= maxTimeout.Seconds() {
+			return maxTimeout, true
+		}
+		d = time.Duration(secs * float64(time.Second))
+	}
+	if d <= 0 {
+		return 0, false
+	}
+	if d > maxTimeout {
+		d = maxTimeout
+	}
+	return d, true
+}
+
+// getForecasts returns the forecasts of the given cities in order. Each city
+// is given an equal share of the time left before the deadline of ctx among
+// the cities not yet retrieved, so that a slow city cannot use the time of the
+// others, and a fast one leaves more to the next. The cities whose forecast
+// was not retrieved in time are returned with the timeout status, those which
+// needed upstream calls while the request was shed with the overloaded
+// status, and those whose forecast is unavailable are omitted. An error is
+// returned if a city could not be resolved to a place, or wrapping errShed if
+// the request was shed and no forecast could be served from the cache.
+func (h *GetForecastHandler) getForecasts(ctx context.Context, cities []string) ([]*v1.Forecast, error) {
+	deadline, _ := ctx.Deadline()
+	forecasts := make([]*v1.Forecast, 0, len(cities))
+	var shed error
+	served := 0
+	for i, city := range cities {
+		budget := time.Until(deadline) / time.Duration(len(cities)-i)
+		h.log(ctx).Debugw("Getting forecast for city", "city", city, "budget", budget)
+
+		forecast, err := h.getCityForecast(ctx, city, budget)
+		if errors.Is(err, errShed) {
+			// the other cities may still be served from the cache
+			shed = err
+			forecasts = append(forecasts, &v1.Forecast{Name: displayName(city), Status: v1.ForecastStatusOverloaded})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if forecast == nil {
+			// graceful degradation; continue with other cities
 			continue
 		}
+		if forecast.Status == "" {
+			served++
+		}
+		forecasts = append(forecasts, forecast)
+	}
+	if shed != nil && served == 0 {
+		return nil, shed
+	}
+	return forecasts, nil
+}
+
+// getCityForecast returns the forecast for the given city retrieved within
+// budget, or the forecast of the city with the timeout status if it was not.
+func (h *GetForecastHandler) getCityForecast(ctx context.Context, city string, budget time.Duration) (*v1.Forecast, error) {
+	ctx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+	forecast, err := h.getForecast(ctx, city)
+	if forecast == nil && ctx.Err() != nil {
+		h.log(ctx).Warnw("Timed out getting forecast for city", "city", city, "budget", budget)
+		return &v1.Forecast{Name: displayName(city), Status: v1.ForecastStatusTimeout}, nil
+	}
+	return forecast, err
+}
+
+// Wait blocks until all background refreshes have completed.
+func (h *GetForecastHandler) Wait() {
+	h.refreshes.Wait()
+}
+
+// getForecast returns the forecast for the given city, from the cache if
+// possible. Forecasts are cached under the canonical key of the grid point a
+// city resolves to, so that all spellings of a city share the same entry. It
+// returns a nil forecast if the forecast is unavailable, and an error only if
+// the city could not be resolved to a place or the request was shed.
+func (h *GetForecastHandler) getForecast(ctx context.Context, city string) (*v1.Forecast, error) {
+	ctx, span := h.tracer.Start(ctx, "getForecast", trace.WithAttributes(attribute.String("city", city)))
+	defer span.End()
+
+	name := displayName(city)
+
+	key, points, err := h.resolve(ctx, city)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "resolving city")
+	}
+	if err != nil || key == "" {
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("cache.key", key))
+
+	// use value from cache if present
+	_, lookup := h.startCacheSpan(ctx, "forecast", "Lookup")
+	forecast, storedAt, fresh, exists := h.cache.Lookup(key)
+	endCacheSpan(lookup, exists)
+	if fresh {
+		usage.FromContext(ctx).CacheHit()
+		named := *forecast
+		named.Name = name
+		return &named, nil
+	}
+
+	// serve an expired forecast within the grace window right away and
+	// refresh it in the background
+	if exists {
+		usage.FromContext(ctx).CacheHit()
+		stale := *forecast
+		stale.Name = name
+		stale.Stale = true
+		stale.Age = int64(time.Since(storedAt).Seconds())
+		span.SetAttributes(attribute.Bool("forecast.stale", true))
+		h.refreshInBackground(ctx, city, key)
+		return &stale, nil
+	}
+
+	if err := h.admit(ctx); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "admitting request")
+		return nil, err
+	}
+	forecast, err = h.refreshForecast(ctx, city, key, points)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "refreshing forecast")
+	}
+	if err != nil || forecast == nil {
+		return nil, err
+	}
+	forecast.Name = name
+	return forecast, nil
+}
+
+// resolve returns the canonical key of the given city, using the alias cache
+// if configured. The points metadata of the city is also returned when it had
+// to be looked up. An empty key is returned if the city cannot be resolved.
+func (h *GetForecastHandler) resolve(ctx context.Context, city string) (string, *weathergov.Points, error) {
+	alias := normalizeCity(city)
+	if h.aliasCache != nil {
+		_, lookup := h.startCacheSpan(ctx, "alias", "Get")
+		key, exists := h.aliasCache.Get(alias)
+		endCacheSpan(lookup, exists)
+		if exists {
+			return key, nil, nil
+		}
+	}
+
+	if err := h.admit(ctx); err != nil {
+		return "", nil, err
+	}
+	points, err := h.lookupPoints(ctx, city)
+	if err != nil || points == nil {
+		return "", nil, err
+	}
+
+	key := canonicalKey(points)
+	if h.aliasCache != nil {
+		h.aliasCache.Set(alias, key, 0)
+	}
+	return key, points, nil
+}
+
+// refreshInBackground refreshes the forecast cached under the given key
+// unless a refresh is already in progress or it is not admitted. A failed
+// refresh leaves the cached entry untouched, so that it keeps being served
+// until its grace window ends. The refresh is traced in its own trace, linked
+// to the span in ctx, and its upstream calls are charged to the consumer of
+// the request in ctx.
+func (h *GetForecastHandler) refreshInBackground(ctx context.Context, city, key string) {
+	link := trace.LinkFromContext(ctx)
+	logger := h.log(ctx)
+	record := usage.FromContext(ctx)
+
+	h.mu.Lock()
+	if _, found := h.refreshing[key]; found {
+		h.mu.Unlock()
+		return
+	}
+	h.refreshing[key] = struct{}{}
+	h.mu.Unlock()
+
+	h.refreshes.Add(1)
+	go func() {
+		defer h.refreshes.Done()
+		defer func() {
+			h.mu.Lock()
+			delete(h.refreshing, key)
+			h.mu.Unlock()
+		}()
+
+		ctx := usage.NewContext(logging.NewContext(context.Background(), logger), record)
+		ctx, cancel := context.WithTimeout(ctx, time.Duration(h.timeout.Load()))
+		defer cancel()
+		ctx, span := h.tracer.Start(ctx, "refreshInBackground",
+			trace.WithNewRoot(),
+			trace.WithLinks(link),
+			trace.WithAttributes(attribute.String("city", city), attribute.String("cache.key", key)),
+		)
+		defer span.End()
+
+		if h.admission != nil {
+			release, err := h.admission.Acquire(ctx)
+			if err != nil {
+				span.SetStatus(codes.Error, "admitting refresh")
+				logger.Warnw("Skipped refresh of stale forecast", "error", err, "city", city)
+				return
+			}
+			defer release()
+		}
+		forecast, err := h.refreshForecast(ctx, city, key, nil)
+		if err != nil || forecast == nil {
+			span.SetStatus(codes.Error, "refreshing forecast")
+			logger.Warnw("Failed to refresh stale forecast", "error", err, "city", city)
+		}
+	}()
+}
+
+// refreshForecast retrieves the forecast for the given city from upstream and
+// caches it under key. The points metadata of the city is looked up unless
+// given. It returns a nil forecast if the forecast is unavailable, and an
+// error only if the city could not be resolved to a place.
+func (h *GetForecastHandler) refreshForecast(ctx context.Context, city, key string, points *weathergov.Points) (*v1.Forecast, error) {
+	if points == nil {
+		var err error
+		points, err = h.lookupPoints(ctx, city)
+		if err != nil || points == nil {
+			return nil, err
+		}
+	}
+
+	forecastResp, err := h.weatherGovAPI.GetForecast(ctx, points.Properties.Forecast)
+	if err != nil {
+		h.log(ctx).Errorw("Failed to retrieve weather point details for city",
+			"error", err,
+			"city", city,
+		)
+		return nil, nil
+	}
+
+	forecast := &v1.Forecast{
+		Name: cases.Title(language.English).String(city),
+	}
+
+	twoDaysLater := time.Now().UTC().AddDate(0, 0, 2)
+	for _, period := range forecastResp.Properties.Periods {
+		// we only include day time forecast for today and next two days
+		if period.IsDaytime && time.Time(period.StartTime).After(twoDaysLater) {
+			break
+		}
+		forecast.Detail = append(forecast.Detail, &v1.Detail{
+			StartTime:   period.StartTime,
+			EndTime:     period.EndTime,
+			Description: period.DetailedForecast,
+		})
+	}
+
+	// prefer the freshness advertised by upstream over the configured TTL
+	var ttl time.Duration
+	if !forecastResp.Expires.IsZero() {
+		ttl = time.Until(forecastResp.Expires)
+		if ttl < minForecastTTL {
+			ttl = minForecastTTL
+		}
+	}
+	cached := *forecast
+	h.cache.Set(key, &cached, ttl)
+
+	return forecast, nil
+}
+
+// lookupPoints returns the points metadata of the given city. It returns nil
+// points if the city has no place or points, and an error only if the city
+// could not be resolved to a place.
+func (h *GetForecastHandler) lookupPoints(ctx context.Context, city string) (*weathergov.Points, error) {
+	place, err := h.getPlace(ctx, city)
+	if err != nil {
+		h.log(ctx).Errorw("Failed to retrieve coordinates for city",
+			"error", err,
+			"city", city,
+		)
+		return nil, err
+	}
+	if place == nil {
+		h.log(ctx).Errorw("Failed to retrieve place details for city", "city", city)
+		return nil, nil
+	}
+
+	points, err := h.getPoints(ctx, place)
+	if err != nil {
+		h.log(ctx).Errorw("Failed to retrieve weather point details",
+			"error", err,
+			"city", city,
+		)
+		return nil, nil
+	}
+	return points, nil
+}
 
-		q := fmt.Sprintf("%s,%s", city, defaultCountry)
+// getPlace returns the place for the given city, using the place cache if
+// configured. It returns nil if no place matches the city.
+func (h *GetForecastHandler) getPlace(ctx context.Context, city string) (*openstreetmap.Place, error) {
+	q := fmt.Sprintf("%s,%s", normalizeCity(city), h.country)
+	search := func(ctx context.Context) (*openstreetmap.Place, error) {
 		places, err := h.openStreetMapAPI.GetPlace(ctx, &openstreetmap.GetOptions{
 			Query:  q,
 			Format: defaultFormat,
 		})
 		if err != nil {
-			h.logger.Errorw("Failed to retrieve coordinates for city",
-				"error", err,
-				"city", city,
-			)
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to retrieve weather forecast"})
-			return
+			return nil, err
 		}
-
 		if len(places) < 1 {
-			h.logger.Errorw("Failed to retrieve place details for city", "city", city)
-			// graceful degradation; continue with other cities
-			continue
+			return nil, errPlaceNotFound
 		}
 
 		// IMPORTANT: defaults to first record; requires further analysis
 		// of response to narrow down result
-		place := places[0]
+		return places[0], nil
+	}
 
-		forecast := &v1.Forecast{
-			Name: cases.Title(language.English).String(city),
-		}
+	var place *openstreetmap.Place
+	var err error
+	if h.placeCache != nil {
+		ctx, lookup := h.startCacheSpan(ctx, "place", "GetOrLoad")
+		place, err = h.placeCache.GetOrLoad(ctx, q, search)
+		lookup.End()
+	} else {
+		place, err = search(ctx)
+	}
+	if errors.Is(err, errPlaceNotFound) {
+		return nil, nil
+	}
+	return place, err
+}
 
-		points, err := h.weatherGovAPI.GetPoints(ctx, &weathergov.Coordinates{
+// getPoints returns the points metadata for the given place, using the points
+// cache if configured.
+func (h *GetForecastHandler) getPoints(ctx context.Context, place *openstreetmap.Place) (*weathergov.Points, error) {
+	k := fmt.Sprintf("%s,%s", place.Lat, place.Lon)
+	lookup := func(ctx context.Context) (*weathergov.Points, error) {
+		return h.weatherGovAPI.GetPoints(ctx, &weathergov.Coordinates{
 			Lat: place.Lat,
 			Lon: place.Lon,
 		})
-		if err != nil {
-			// graceful degradation; continue with other places despite err
-			h.logger.Errorw("Failed to retrieve weather point details",
-				"error", err,
-				"city", city,
-			)
-		}
+	}
 
-		forecastResp, err := h.weatherGovAPI.GetForecast(ctx, points.Properties.Forecast)
-		if err != nil {
-			// graceful degradation; continue with other places despite err
-			h.logger.Errorw("Failed to retrieve weather point details for city",
-				"error", err,
-				"city", city,
-			)
-			continue
-		}
+	if h.pointsCache != nil {
+		ctx, span := h.startCacheSpan(ctx, "points", "GetOrLoad")
+		defer span.End()
+		return h.pointsCache.GetOrLoad(ctx, k, lookup)
+	}
+	return lookup(ctx)
+}
 
-		twoDaysLater := time.Now().UTC().AddDate(0, 0, 2)
-		for _, period := range forecastResp.Properties.Periods {
-			// we only include day time forecast for today and next two days
-			if period.IsDaytime && time.Time(period.StartTime).After(twoDaysLater) {
-				break
-			}
-			forecast.Detail = append(forecast.Detail, &v1.Detail{
-				StartTime:   period.StartTime,
-				EndTime:     period.EndTime,
-				Description: period.DetailedForecast,
-			})
-		}
+// ticketKey is the context key of the ticket of a request.
+type ticketKey struct{}
 
-		forecasts = append(forecasts, forecast)
-		h.cache.Set(city, forecast)
+// ticket admits a request the first time it needs to call upstream APIs, so
+// that requests served from the cache are never shed. It is safe for
+// concurrent use.
+type ticket struct {
+	admission Admission
+
+	releaseFn func()
+	err       error
+	mu        sync.Mutex
+}
+
+// acquire admits the request unless it already was, returning the error of
+// the attempt which shed it. An attempt abandoned because ctx is done is
+// not remembered, as ctx may be the context of a single city.
+func (t *ticket) acquire(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.releaseFn != nil || t.err != nil {
+		return t.err
+	}
+	release, err := t.admission.Acquire(ctx)
+	if err != nil && ctx.Err() != nil {
+		return err
 	}
+	t.releaseFn, t.err = release, err
+	return err
+}
 
-	c.JSON(http.StatusOK, &v1.ListWeatherResponse{
-		Forecast: forecasts,
-	})
+// release releases the request if it was admitted.
+func (t *ticket) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.releaseFn != nil {
+		t.releaseFn()
+	}
+}
+
+// admit admits the request in ctx to call upstream APIs, if the handler is
+// configured with an admission. It returns an error wrapping errShed if the
+// request is shed.
+func (h *GetForecastHandler) admit(ctx context.Context) error {
+	t, ok := ctx.Value(ticketKey{}).(*ticket)
+	if !ok {
+		return nil
+	}
+	if err := t.acquire(ctx); err != nil {
+		if ctx.Err() == nil {
+			h.log(ctx).Warnw("Shed request", "error", err)
+		}
+		return fmt.Errorf("%w: %v", errShed, err)
+	}
+	return nil
+}
+
+// log returns the logger of the request in ctx, or the logger of the handler.
+func (h *GetForecastHandler) log(ctx context.Context) *zap.SugaredLogger {
+	return logging.FromContext(ctx, h.logger)
+}
+
+// startCacheSpan starts a span for the given operation on the named cache.
+func (h *GetForecastHandler) startCacheSpan(ctx context.Context, name, op string) (context.Context, trace.Span) {
+	return h.tracer.Start(ctx, "cache."+name+"."+op, trace.WithAttributes(attribute.String("cache.name", name)))
+}
+
+// endCacheSpan ends a span started by startCacheSpan, recording whether the
+// lookup was a hit.
+func endCacheSpan(span trace.Span, hit bool) {
+	span.SetAttributes(attribute.Bool("cache.hit", hit))
+	span.End()
+}
+
+// displayName returns the name of the given city in forecasts, which is
+// title-cased and stripped of surrounding and repeated whitespace.
+func displayName(city string) string {
+	return cases.Title(language.English).String(strings.Join(strings.Fields(city), " "))
+}
+
+// normalizeCity returns the alias of the given city, which is lower-cased and
+// stripped of surrounding and repeated whitespace.
+func normalizeCity(city string) string {
+	return strings.ToLower(strings.Join(strings.Fields(city), " "))
+}
+
+// canonicalKey returns the key forecasts are cached under for the given
+// points, which identifies the forecast grid point.
+func canonicalKey(points *weathergov.Points) string {
+	p := points.Properties
+	if p.GridID == "" {
+		return p.Forecast
+	}
+	return fmt.Sprintf("%s/%d,%d", p.GridID, p.GridX, p.GridY)
 }
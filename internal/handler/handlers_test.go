@@ -12,14 +12,19 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"go.uber.org/zap/zaptest"
 
 	v1 "github.com/cityhunteur/weather-service/api/v1"
+	"github.com/cityhunteur/weather-service/internal/admission"
+	"github.com/cityhunteur/weather-service/internal/auth"
 	"github.com/cityhunteur/weather-service/internal/cache"
 	"github.com/cityhunteur/weather-service/internal/handler"
 	"github.com/cityhunteur/weather-service/internal/handler/mocks"
 	"github.com/cityhunteur/weather-service/internal/pkg/openstreetmap"
 	"github.com/cityhunteur/weather-service/internal/pkg/weathergov"
+	"github.com/cityhunteur/weather-service/internal/usage"
 )
 
 func TestGetForecastHandler_GetForecast(t *testing.T) {
@@ -127,8 +132,8 @@ func TestGetForecastHandler_GetForecast(t *testing.T) {
 						},
 					},
 				}
-				mockCache.On("Set", "New York", forecast).Return(nil).Times(1)
-				mockCache.On("Get", mock.Anything, mock.Anything).Return(forecast, true)
+				mockCache.On("Set", "New York", forecast, mock.Anything).Return(nil).Times(1)
+				mockCache.On("Lookup", mock.Anything).Return(forecast, now, true, true)
 			},
 		},
 	}
@@ -141,7 +146,7 @@ func TestGetForecastHandler_GetForecast(t *testing.T) {
 			tt.openStreetMapAPIExpectations(mockOpenStreetMapAPI)
 			mockWeatherGovAPI := mocks.NewWeatherGovAPI(t)
 			tt.weatherGovAPIExpectations(mockWeatherGovAPI)
-			h := handler.NewGetForecastHandler(logger, mockOpenStreetMapAPI, mockWeatherGovAPI, cache.NewStore())
+			h := handler.NewGetForecastHandler(logger, mockOpenStreetMapAPI, mockWeatherGovAPI, cache.NewStore[string, *v1.Forecast]())
 
 			resp := httptest.NewRecorder()
 			_, router := gin.CreateTestContext(resp)
@@ -170,3 +175,576 @@ func TestGetForecastHandler_GetForecast(t *testing.T) {
 		})
 	}
 }
+
+func TestGetForecastHandler_GetForecast_LookupCaches(t *testing.T) {
+	t.Parallel()
+	logger := zaptest.NewLogger(t).Sugar()
+
+	mockOpenStreetMapAPI := mocks.NewOpenStreetMapAPI(t)
+	mockOpenStreetMapAPI.On("GetPlace", mock.Anything, mock.Anything).Return([]*openstreetmap.Place{
+		{
+			ID:          366998854,
+			Lat:         "40.7127281",
+			Lon:         "-74.0060152",
+			DisplayName: "City of New York, New York, United States",
+		},
+	}, nil).Once()
+
+	mockWeatherGovAPI := mocks.NewWeatherGovAPI(t)
+	mockWeatherGovAPI.On("GetPoints", mock.Anything, mock.Anything).Return(&weathergov.Points{
+		ID: "https://api.weather.gov/points/40.7127,-74.006",
+		Properties: weathergov.PointsProperties{
+			Forecast: "https://api.weather.gov/gridpoints/OKX/33,35/forecast",
+		},
+	}, nil).Once()
+	mockWeatherGovAPI.On("GetForecast", mock.Anything, "https://api.weather.gov/gridpoints/OKX/33,35/forecast").Return(&weathergov.Forecast{
+		Properties: weathergov.ForecastProperties{
+			Periods: []weathergov.Periods{
+				{
+					Name:             "Tonight",
+					DetailedForecast: "Clear, with a low around 70.",
+				},
+			},
+		},
+	}, nil).Twice()
+
+	// a forecast cache that always misses forces a refresh on every request
+	mockCache := mocks.NewCache(t)
+	mockCache.On("Lookup", mock.Anything).Return(nil, time.Time{}, false, false)
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything)
+
+	h := handler.NewGetForecastHandler(logger, mockOpenStreetMapAPI, mockWeatherGovAPI, mockCache,
+		handler.WithPlaceCache(cache.NewStore[string, *openstreetmap.Place](cache.WithTTL(time.Hour))),
+		handler.WithPointsCache(cache.NewStore[string, *weathergov.Points](cache.WithTTL(time.Hour))),
+	)
+
+	_, router := gin.CreateTestContext(httptest.NewRecorder())
+	router.GET("/v1/weather", h.GetForecast)
+	for i := 0; i < 2; i++ {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), "GET", "/v1/weather?city=new%20york", nil)
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	}
+}
+
+func TestGetForecastHandler_GetForecast_Expires(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		expires time.Time
+		wantTTL func(ttl time.Duration) bool
+	}{
+		{
+			name:    "store ttl",
+			wantTTL: func(ttl time.Duration) bool { return ttl == 0 },
+		},
+		{
+			name:    "advertised by upstream",
+			expires: time.Now().Add(2 * time.Hour),
+			wantTTL: func(ttl time.Duration) bool { return ttl > time.Hour && ttl <= 2*time.Hour },
+		},
+		{
+			name:    "already expired",
+			expires: time.Now().Add(-time.Minute),
+			wantTTL: func(ttl time.Duration) bool { return ttl == time.Minute },
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			logger := zaptest.NewLogger(t).Sugar()
+
+			mockOpenStreetMapAPI := mocks.NewOpenStreetMapAPI(t)
+			mockOpenStreetMapAPI.On("GetPlace", mock.Anything, mock.Anything).Return([]*openstreetmap.Place{
+				{
+					ID:  366998854,
+					Lat: "40.7127281",
+					Lon: "-74.0060152",
+				},
+			}, nil).Once()
+
+			mockWeatherGovAPI := mocks.NewWeatherGovAPI(t)
+			mockWeatherGovAPI.On("GetPoints", mock.Anything, mock.Anything).Return(&weathergov.Points{
+				Properties: weathergov.PointsProperties{
+					GridID:   "OKX",
+					GridX:    33,
+					GridY:    35,
+					Forecast: "https://api.weather.gov/gridpoints/OKX/33,35/forecast",
+				},
+			}, nil).Once()
+			mockWeatherGovAPI.On("GetForecast", mock.Anything, mock.Anything).Return(&weathergov.Forecast{
+				Properties: weathergov.ForecastProperties{
+					Periods: []weathergov.Periods{{Name: "Tonight", DetailedForecast: "Clear."}},
+				},
+				Expires: tt.expires,
+			}, nil).Once()
+
+			mockCache := mocks.NewCache(t)
+			mockCache.On("Lookup", "OKX/33,35").Return(nil, time.Time{}, false, false)
+			mockCache.On("Set", "OKX/33,35", mock.Anything, mock.MatchedBy(tt.wantTTL)).Once()
+
+			h := handler.NewGetForecastHandler(logger, mockOpenStreetMapAPI, mockWeatherGovAPI, mockCache)
+			resp := httptest.NewRecorder()
+			_, router := gin.CreateTestContext(resp)
+			router.GET("/v1/weather", h.GetForecast)
+			req, _ := http.NewRequestWithContext(context.Background(), "GET", "/v1/weather?city=new%20york", nil)
+			router.ServeHTTP(resp, req)
+			assert.Equal(t, http.StatusOK, resp.Code)
+		})
+	}
+}
+
+func TestGetForecastHandler_GetForecast_Stale(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name             string
+		forecastErr      error
+		wantCacheRefresh bool
+	}{
+		{
+			name:             "refreshes in background",
+			wantCacheRefresh: true,
+		},
+		{
+			name:        "keeps stale entry when refresh fails",
+			forecastErr: fmt.Errorf("service unavailable"),
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			logger := zaptest.NewLogger(t).Sugar()
+
+			mockOpenStreetMapAPI := mocks.NewOpenStreetMapAPI(t)
+			mockOpenStreetMapAPI.On("GetPlace", mock.Anything, mock.Anything).Return([]*openstreetmap.Place{
+				{
+					ID:  366998854,
+					Lat: "40.7127281",
+					Lon: "-74.0060152",
+				},
+			}, nil).Once()
+
+			mockWeatherGovAPI := mocks.NewWeatherGovAPI(t)
+			mockWeatherGovAPI.On("GetPoints", mock.Anything, mock.Anything).Return(&weathergov.Points{
+				Properties: weathergov.PointsProperties{
+					GridID:   "OKX",
+					GridX:    33,
+					GridY:    35,
+					Forecast: "https://api.weather.gov/gridpoints/OKX/33,35/forecast",
+				},
+			}, nil).Once()
+			var forecastResp *weathergov.Forecast
+			if tt.forecastErr == nil {
+				forecastResp = &weathergov.Forecast{
+					Properties: weathergov.ForecastProperties{
+						Periods: []weathergov.Periods{{Name: "Tonight", DetailedForecast: "Clear."}},
+					},
+				}
+			}
+			// the refresh is charged to the consumer of the request
+			charged := mock.MatchedBy(func(ctx context.Context) bool { return usage.FromContext(ctx) != nil })
+			mockWeatherGovAPI.On("GetForecast", charged, mock.Anything).Return(forecastResp, tt.forecastErr).Once()
+
+			stale := &v1.Forecast{
+				Name:   "New York",
+				Detail: []*v1.Detail{{Description: "Haze."}},
+			}
+			mockCache := mocks.NewCache(t)
+			mockCache.On("Lookup", "OKX/33,35").Return(stale, time.Now().Add(-40*time.Minute), false, true)
+			if tt.wantCacheRefresh {
+				mockCache.On("Set", "OKX/33,35", mock.Anything, mock.Anything).Once()
+			}
+
+			// the city is already known, so only the background refresh calls upstream
+			aliasCache := cache.NewStore[string, string](cache.WithTTL(time.Hour))
+			aliasCache.Set("new york", "OKX/33,35", 0)
+
+			h := handler.NewGetForecastHandler(logger, mockOpenStreetMapAPI, mockWeatherGovAPI, mockCache,
+				handler.WithAliasCache(aliasCache),
+			)
+
+			resp := httptest.NewRecorder()
+			_, router := gin.CreateTestContext(resp)
+			router.GET("/v1/weather", usage.NewTracker(usage.Quota{}).Middleware(logger), h.GetForecast)
+			ctx := auth.NewContext(context.Background(), &auth.Identity{Name: "mobile-app", Method: auth.MethodAPIKey})
+			req, _ := http.NewRequestWithContext(ctx, "GET", "/v1/weather?city=new%20york", nil)
+			router.ServeHTTP(resp, req)
+			h.Wait()
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+			var got v1.ListWeatherResponse
+			err := json.NewDecoder(resp.Body).Decode(&got)
+			assert.NoError(t, err)
+			assert.Len(t, got.Forecast, 1)
+			assert.True(t, got.Forecast[0].Stale)
+			assert.InDelta(t, 40*60, got.Forecast[0].Age, 5)
+			assert.Equal(t, "Haze.", got.Forecast[0].Detail[0].Description)
+			assert.False(t, stale.Stale, "cached forecast must not be modified")
+		})
+	}
+}
+
+func TestGetForecastHandler_GetForecast_CanonicalKey(t *testing.T) {
+	t.Parallel()
+	logger := zaptest.NewLogger(t).Sugar()
+
+	mockOpenStreetMapAPI := mocks.NewOpenStreetMapAPI(t)
+	for _, q := range []string{"new york,USA", "nyc,USA"} {
+		mockOpenStreetMapAPI.On("GetPlace", mock.Anything, &openstreetmap.GetOptions{Query: q, Format: "json"}).Return([]*openstreetmap.Place{
+			{
+				ID:  366998854,
+				Lat: "40.7127281",
+				Lon: "-74.0060152",
+			},
+		}, nil).Once()
+	}
+
+	mockWeatherGovAPI := mocks.NewWeatherGovAPI(t)
+	mockWeatherGovAPI.On("GetPoints", mock.Anything, mock.Anything).Return(&weathergov.Points{
+		Properties: weathergov.PointsProperties{
+			GridID:   "OKX",
+			GridX:    33,
+			GridY:    35,
+			Forecast: "https://api.weather.gov/gridpoints/OKX/33,35/forecast",
+		},
+	}, nil).Twice()
+	mockWeatherGovAPI.On("GetForecast", mock.Anything, mock.Anything).Return(&weathergov.Forecast{
+		Properties: weathergov.ForecastProperties{
+			Periods: []weathergov.Periods{{Name: "Tonight", DetailedForecast: "Clear."}},
+		},
+	}, nil).Once()
+
+	store := cache.NewStore[string, *v1.Forecast]()
+	h := handler.NewGetForecastHandler(logger, mockOpenStreetMapAPI, mockWeatherGovAPI, store,
+		handler.WithAliasCache(cache.NewStore[string, string](cache.WithTTL(time.Hour))),
+	)
+
+	tracker := usage.NewTracker(usage.Quota{})
+	resp := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(resp)
+	router.GET("/v1/weather", tracker.Middleware(logger), h.GetForecast)
+	ctx := auth.NewContext(context.Background(), &auth.Identity{Name: "mobile-app", Method: auth.MethodAPIKey})
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/v1/weather?city=new%20york,%20NEW%20%20York,nyc", nil)
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var got v1.ListWeatherResponse
+	err := json.NewDecoder(resp.Body).Decode(&got)
+	assert.NoError(t, err)
+	assert.Len(t, got.Forecast, 3)
+	for i, name := range []string{"New York", "New York", "Nyc"} {
+		assert.Equal(t, name, got.Forecast[i].Name)
+		assert.Equal(t, "Clear.", got.Forecast[i].Detail[0].Description)
+	}
+	assert.Equal(t, 1, store.Len())
+
+	// spellings of the city resolving to the cached forecast are cache hits
+	assert.Equal(t, usage.Counters{Requests: 1, Cities: 3, CacheHits: 2}, tracker.Month("mobile-app"))
+}
+
+func TestGetForecastHandler_GetForecast_Admission(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name           string
+		query          string
+		admit          bool
+		wantStatusCode int
+		wantForecasts  int
+		wantShed       []string
+	}{
+		{
+			name:           "cached while shedding",
+			query:          "?city=new%20york,NYC",
+			wantStatusCode: http.StatusOK,
+			wantForecasts:  2,
+		},
+		{
+			name:           "cache miss while shedding",
+			query:          "?city=new%20york,chicago",
+			wantStatusCode: http.StatusOK,
+			wantForecasts:  2,
+			wantShed:       []string{"Chicago"},
+		},
+		{
+			name:           "only cache misses while shedding",
+			query:          "?city=chicago,boston",
+			wantStatusCode: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "cache misses admitted once",
+			query:          "?city=new%20york,chicago,san%20francisco",
+			admit:          true,
+			wantStatusCode: http.StatusOK,
+			wantForecasts:  3,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			logger := zaptest.NewLogger(t).Sugar()
+
+			mockOpenStreetMapAPI := mocks.NewOpenStreetMapAPI(t)
+			mockWeatherGovAPI := mocks.NewWeatherGovAPI(t)
+			mockAdmission := mocks.NewAdmission(t)
+			released := 0
+			switch {
+			case tt.admit:
+				mockAdmission.On("Acquire", mock.Anything).Return(func() { released++ }, nil).Once()
+				mockOpenStreetMapAPI.On("GetPlace", mock.Anything, mock.Anything).Return([]*openstreetmap.Place{
+					{Lat: "41.8755616", Lon: "-87.6244212"},
+				}, nil)
+				mockWeatherGovAPI.On("GetPoints", mock.Anything, mock.Anything).Return(&weathergov.Points{
+					Properties: weathergov.PointsProperties{
+						GridID:   "LOT",
+						GridX:    76,
+						GridY:    73,
+						Forecast: "https://api.weather.gov/gridpoints/LOT/76,73/forecast",
+					},
+				}, nil)
+				mockWeatherGovAPI.On("GetForecast", mock.Anything, mock.Anything).Return(&weathergov.Forecast{
+					Properties: weathergov.ForecastProperties{
+						Periods: []weathergov.Periods{{Name: "Tonight", DetailedForecast: "Clear."}},
+					},
+				}, nil).Once()
+			case tt.wantStatusCode != http.StatusOK || len(tt.wantShed) > 0:
+				mockAdmission.On("Acquire", mock.Anything).Return(nil, admission.ErrOverloaded).Once()
+			}
+
+			store := cache.NewStore[string, *v1.Forecast]()
+			aliases := cache.NewStore[string, string]()
+			if !tt.admit {
+				store.Set("OKX/33,35", &v1.Forecast{Detail: []*v1.Detail{{Description: "Sunny."}}}, time.Hour)
+				aliases.Set("new york", "OKX/33,35", time.Hour)
+				aliases.Set("nyc", "OKX/33,35", time.Hour)
+			}
+			h := handler.NewGetForecastHandler(logger, mockOpenStreetMapAPI, mockWeatherGovAPI, store,
+				handler.WithAliasCache(aliases),
+				handler.WithAdmission(mockAdmission),
+			)
+
+			resp := httptest.NewRecorder()
+			_, router := gin.CreateTestContext(resp)
+			router.GET("/v1/weather", h.GetForecast)
+			req, _ := http.NewRequestWithContext(context.Background(), "GET", "/v1/weather"+tt.query, nil)
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.wantStatusCode, resp.Code)
+			if tt.wantStatusCode != http.StatusOK {
+				assert.Equal(t, "1", resp.Header().Get("Retry-After"))
+				return
+			}
+			var got v1.ListWeatherResponse
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+			assert.Len(t, got.Forecast, tt.wantForecasts)
+			var shed []string
+			for _, f := range got.Forecast {
+				if f.Status == v1.ForecastStatusOverloaded {
+					shed = append(shed, f.Name)
+				}
+			}
+			assert.Equal(t, tt.wantShed, shed)
+			if tt.admit {
+				assert.Equal(t, 1, released)
+			}
+		})
+	}
+}
+
+func TestGetForecastHandler_GetForecast_Tracing(t *testing.T) {
+	t.Parallel()
+	logger := zaptest.NewLogger(t).Sugar()
+
+	mockOpenStreetMapAPI := mocks.NewOpenStreetMapAPI(t)
+	mockOpenStreetMapAPI.On("GetPlace", mock.Anything, mock.Anything).Return([]*openstreetmap.Place{
+		{Lat: "40.7127281", Lon: "-74.0060152"},
+	}, nil).Once()
+
+	mockWeatherGovAPI := mocks.NewWeatherGovAPI(t)
+	mockWeatherGovAPI.On("GetPoints", mock.Anything, mock.Anything).Return(&weathergov.Points{
+		Properties: weathergov.PointsProperties{
+			GridID:   "OKX",
+			GridX:    33,
+			GridY:    35,
+			Forecast: "https://api.weather.gov/gridpoints/OKX/33,35/forecast",
+		},
+	}, nil).Once()
+	mockWeatherGovAPI.On("GetForecast", mock.Anything, mock.Anything).Return(&weathergov.Forecast{
+		Properties: weathergov.ForecastProperties{
+			Periods: []weathergov.Periods{{Name: "Tonight", DetailedForecast: "Clear."}},
+		},
+	}, nil).Once()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	h := handler.NewGetForecastHandler(logger, mockOpenStreetMapAPI, mockWeatherGovAPI, cache.NewStore[string, *v1.Forecast](),
+		handler.WithAliasCache(cache.NewStore[string, string]()),
+		handler.WithPlaceCache(cache.NewStore[string, *openstreetmap.Place]()),
+		handler.WithPointsCache(cache.NewStore[string, *weathergov.Points]()),
+		handler.WithTracerProvider(tp),
+	)
+
+	resp := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(resp)
+	router.GET("/v1/weather", h.GetForecast)
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/v1/weather?city=new%20york", nil)
+	router.ServeHTTP(resp, req)
+	parent.End()
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	names := make(map[string]bool)
+	for _, span := range recorder.Ended() {
+		names[span.Name()] = true
+		assert.Equal(t, parent.SpanContext().TraceID(), span.SpanContext().TraceID(), span.Name())
+	}
+	for _, name := range []string{
+		"getForecast",
+		"cache.alias.Get",
+		"cache.place.GetOrLoad",
+		"cache.points.GetOrLoad",
+		"cache.forecast.Lookup",
+	} {
+		assert.True(t, names[name], "missing span %s", name)
+	}
+}
+
+func TestGetForecastHandler_SetTimeout(t *testing.T) {
+	t.Parallel()
+	logger := zaptest.NewLogger(t).Sugar()
+
+	var remaining time.Duration
+	mockOpenStreetMapAPI := mocks.NewOpenStreetMapAPI(t)
+	mockOpenStreetMapAPI.On("GetPlace", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		deadline, _ := args.Get(0).(context.Context).Deadline()
+		remaining = time.Until(deadline)
+	}).Return(nil, nil).Once()
+
+	h := handler.NewGetForecastHandler(logger, mockOpenStreetMapAPI, mocks.NewWeatherGovAPI(t), cache.NewStore[string, *v1.Forecast](),
+		handler.WithTimeout(time.Minute),
+	)
+	h.SetTimeout(time.Second)
+
+	resp := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(resp)
+	router.GET("/v1/weather", h.GetForecast)
+	req, _ := http.NewRequestWithContext(context.Background(), "GET", "/v1/weather?city=chicago", nil)
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.LessOrEqual(t, remaining, time.Second)
+}
+
+func TestGetForecastHandler_GetForecast_RequestTimeout(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name           string
+		target         string
+		header         string
+		wantStatusCode int
+		wantTimeout    time.Duration
+	}{
+		{name: "server timeout", target: "/v1/weather?city=chicago", wantStatusCode: http.StatusOK, wantTimeout: 10 * time.Second},
+		{name: "header", target: "/v1/weather?city=chicago", header: "1500ms", wantStatusCode: http.StatusOK, wantTimeout: 1500 * time.Millisecond},
+		{name: "seconds", target: "/v1/weather?city=chicago", header: "2.5", wantStatusCode: http.StatusOK, wantTimeout: 2500 * time.Millisecond},
+		{name: "param", target: "/v1/weather?city=chicago&timeout=3s", wantStatusCode: http.StatusOK, wantTimeout: 3 * time.Second},
+		{name: "header over param", target: "/v1/weather?city=chicago&timeout=3s", header: "1s", wantStatusCode: http.StatusOK, wantTimeout: time.Second},
+		{name: "capped", target: "/v1/weather?city=chicago", header: "1m", wantStatusCode: http.StatusOK, wantTimeout: 10 * time.Second},
+		{name: "capped seconds", target: "/v1/weather?city=chicago&timeout=1e300", wantStatusCode: http.StatusOK, wantTimeout: 10 * time.Second},
+		{name: "infinite seconds", target: "/v1/weather?city=chicago", header: "+Inf", wantStatusCode: http.StatusOK, wantTimeout: 10 * time.Second},
+		{name: "invalid", target: "/v1/weather?city=chicago&timeout=soon", wantStatusCode: http.StatusBadRequest},
+		{name: "not positive", target: "/v1/weather?city=chicago", header: "0", wantStatusCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			logger := zaptest.NewLogger(t).Sugar()
+
+			var remaining time.Duration
+			mockOpenStreetMapAPI := mocks.NewOpenStreetMapAPI(t)
+			if tt.wantStatusCode == http.StatusOK {
+				mockOpenStreetMapAPI.On("GetPlace", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+					deadline, _ := args.Get(0).(context.Context).Deadline()
+					remaining = time.Until(deadline)
+				}).Return(nil, nil).Once()
+			}
+			h := handler.NewGetForecastHandler(logger, mockOpenStreetMapAPI, mocks.NewWeatherGovAPI(t), cache.NewStore[string, *v1.Forecast]())
+
+			resp := httptest.NewRecorder()
+			_, router := gin.CreateTestContext(resp)
+			router.GET("/v1/weather", h.GetForecast)
+			req, _ := http.NewRequestWithContext(context.Background(), "GET", tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("X-Request-Timeout", tt.header)
+			}
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.wantStatusCode, resp.Code)
+			if tt.wantStatusCode == http.StatusOK {
+				assert.LessOrEqual(t, remaining, tt.wantTimeout)
+				assert.Greater(t, remaining, tt.wantTimeout-time.Second)
+			}
+		})
+	}
+}
+
+func TestGetForecastHandler_GetForecast_CityBudgets(t *testing.T) {
+	t.Parallel()
+	logger := zaptest.NewLogger(t).Sugar()
+
+	var budget time.Duration
+	slow := mock.MatchedBy(func(opts *openstreetmap.GetOptions) bool { return opts.Query == "boston,USA" })
+	mockOpenStreetMapAPI := mocks.NewOpenStreetMapAPI(t)
+	mockOpenStreetMapAPI.On("GetPlace", mock.Anything, slow).Run(func(args mock.Arguments) {
+		ctx := args.Get(0).(context.Context)
+		deadline, _ := ctx.Deadline()
+		budget = time.Until(deadline)
+		<-ctx.Done()
+	}).Return(nil, context.DeadlineExceeded).Once()
+	mockOpenStreetMapAPI.On("GetPlace", mock.Anything, mock.Anything).Return([]*openstreetmap.Place{
+		{Lat: "41.8755616", Lon: "-87.6244212"},
+	}, nil)
+
+	mockWeatherGovAPI := mocks.NewWeatherGovAPI(t)
+	mockWeatherGovAPI.On("GetPoints", mock.Anything, mock.Anything).Return(&weathergov.Points{
+		Properties: weathergov.PointsProperties{
+			GridID:   "LOT",
+			GridX:    76,
+			GridY:    73,
+			Forecast: "https://api.weather.gov/gridpoints/LOT/76,73/forecast",
+		},
+	}, nil)
+	mockWeatherGovAPI.On("GetForecast", mock.Anything, mock.Anything).Return(&weathergov.Forecast{
+		Properties: weathergov.ForecastProperties{
+			Periods: []weathergov.Periods{{Name: "Tonight", DetailedForecast: "Clear."}},
+		},
+	}, nil)
+
+	h := handler.NewGetForecastHandler(logger, mockOpenStreetMapAPI, mockWeatherGovAPI, cache.NewStore[string, *v1.Forecast]())
+
+	resp := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(resp)
+	router.GET("/v1/weather", h.GetForecast)
+	req, _ := http.NewRequestWithContext(context.Background(), "GET", "/v1/weather?city=boston,chicago,evanston,oak%20park,cicero&timeout=400ms", nil)
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var got v1.ListWeatherResponse
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	if assert.Len(t, got.Forecast, 5) {
+		// the slow city times out within its share of the deadline, and the
+		// others are returned
+		assert.Equal(t, &v1.Forecast{Name: "Boston", Status: v1.ForecastStatusTimeout}, got.Forecast[0])
+		for i, name := range []string{"Chicago", "Evanston", "Oak Park", "Cicero"} {
+			assert.Equal(t, name, got.Forecast[i+1].Name)
+			assert.Empty(t, got.Forecast[i+1].Status)
+			assert.Len(t, got.Forecast[i+1].Detail, 1)
+		}
+	}
+	// the first of five cities is given a fifth of the time
+	assert.LessOrEqual(t, budget, 80*time.Millisecond)
+}
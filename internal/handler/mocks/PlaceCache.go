@@ -0,0 +1,58 @@
+// Code generated by mockery v2.30.16. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	cache "github.com/cityhunteur/weather-service/internal/cache"
+
+	mock "github.com/stretchr/testify/mock"
+
+	openstreetmap "github.com/cityhunteur/weather-service/internal/pkg/openstreetmap"
+)
+
+// PlaceCache is an autogenerated mock type for the PlaceCache type
+type PlaceCache struct {
+	mock.Mock
+}
+
+// GetOrLoad provides a mock function with given fields: ctx, k, fn
+func (_m *PlaceCache) GetOrLoad(ctx context.Context, k string, fn cache.LoadFunc[*openstreetmap.Place]) (*openstreetmap.Place, error) {
+	ret := _m.Called(ctx, k, fn)
+
+	var r0 *openstreetmap.Place
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, cache.LoadFunc[*openstreetmap.Place]) (*openstreetmap.Place, error)); ok {
+		return rf(ctx, k, fn)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, cache.LoadFunc[*openstreetmap.Place]) *openstreetmap.Place); ok {
+		r0 = rf(ctx, k, fn)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*openstreetmap.Place)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, cache.LoadFunc[*openstreetmap.Place]) error); ok {
+		r1 = rf(ctx, k, fn)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewPlaceCache creates a new instance of PlaceCache. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewPlaceCache(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *PlaceCache {
+	mock := &PlaceCache{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
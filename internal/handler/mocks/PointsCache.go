@@ -0,0 +1,58 @@
+// Code generated by mockery v2.30.16. DO NOT EDIT.
+
+package mocks
+
+import (
+	context "context"
+
+	cache "github.com/cityhunteur/weather-service/internal/cache"
+
+	mock "github.com/stretchr/testify/mock"
+
+	weathergov "github.com/cityhunteur/weather-service/internal/pkg/weathergov"
+)
+
+// PointsCache is an autogenerated mock type for the PointsCache type
+type PointsCache struct {
+	mock.Mock
+}
+
+// GetOrLoad provides a mock function with given fields: ctx, k, fn
+func (_m *PointsCache) GetOrLoad(ctx context.Context, k string, fn cache.LoadFunc[*weathergov.Points]) (*weathergov.Points, error) {
+	ret := _m.Called(ctx, k, fn)
+
+	var r0 *weathergov.Points
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, cache.LoadFunc[*weathergov.Points]) (*weathergov.Points, error)); ok {
+		return rf(ctx, k, fn)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, cache.LoadFunc[*weathergov.Points]) *weathergov.Points); ok {
+		r0 = rf(ctx, k, fn)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*weathergov.Points)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, cache.LoadFunc[*weathergov.Points]) error); ok {
+		r1 = rf(ctx, k, fn)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// NewPointsCache creates a new instance of PointsCache. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewPointsCache(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *PointsCache {
+	mock := &PointsCache{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
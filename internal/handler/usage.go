@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	v1 "github.com/cityhunteur/weather-service/api/v1"
+	"github.com/cityhunteur/weather-service/internal/usage"
+)
+
+const dateLayout = "2006-01-02"
+
+// UsageReport reports the usage of the API consumers.
+//
+//go:generate mockery --name UsageReport
+type UsageReport interface {
+	Usage(from, to time.Time) []usage.DailyUsage
+}
+
+// UsageAdminHandler serves the API used to query the usage of the API
+// consumers.
+type UsageAdminHandler struct {
+	usage UsageReport
+	now   func() time.Time
+}
+
+// NewUsageAdminHandler creates an API handler to query the usage of the API
+// consumers.
+func NewUsageAdminHandler(usage UsageReport) *UsageAdminHandler {
+	return &UsageAdminHandler{
+		usage: usage,
+		now:   time.Now,
+	}
+}
+
+// RegisterRoutes registers the usage administration routes on r.
+func (h *UsageAdminHandler) RegisterRoutes(r gin.IRoutes) {
+	r.GET("/usage", h.GetUsage)
+}
+
+// GetUsage returns the daily usage of the consumers between the 'from' and
+// 'to' query params, UTC days formatted as YYYY-MM-DD which default to the
+// current month, optionally restricted to the 'consumer' query param.
+func (h *UsageAdminHandler) GetUsage(c *gin.Context) {
+	today := h.now().UTC().Truncate(24 * time.Hour)
+	from, err := parseDate(c.Query("from"), today.AddDate(0, 0, 1-today.Day()))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Query param 'from' must be a date formatted as YYYY-MM-DD."})
+		return
+	}
+	to, err := parseDate(c.Query("to"), today)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Query param 'to' must be a date formatted as YYYY-MM-DD."})
+		return
+	}
+	consumer := c.Query("consumer")
+
+	resp := &v1.UsageResponse{
+		From:      from.Format(dateLayout),
+		To:        to.Format(dateLayout),
+		Consumers: make([]*v1.ConsumerUsage, 0),
+	}
+	var current *v1.ConsumerUsage
+	for _, u := range h.usage.Usage(from, to) {
+		if consumer != "" && u.Consumer != consumer {
+			continue
+		}
+		if current == nil || current.Consumer != u.Consumer {
+			current = &v1.ConsumerUsage{Consumer: u.Consumer}
+			resp.Consumers = append(resp.Consumers, current)
+		}
+		counters := toUsageCounters(u.Counters)
+		current.Days = append(current.Days, &v1.DailyUsage{Date: u.Day.Format(dateLayout), UsageCounters: counters})
+		current.Total.Requests += counters.Requests
+		current.Total.Cities += counters.Cities
+		current.Total.CacheHits += counters.CacheHits
+		current.Total.UpstreamCalls += counters.UpstreamCalls
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// parseDate parses the date s, which defaults to def.
+func parseDate(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	return time.Parse(dateLayout, s)
+}
+
+func toUsageCounters(c usage.Counters) v1.UsageCounters {
+	return v1.UsageCounters{
+		Requests:      c.Requests,
+		Cities:        c.Cities,
+		CacheHits:     c.CacheHits,
+		UpstreamCalls: c.UpstreamCalls,
+	}
+}
@@ -0,0 +1,140 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	v1 "github.com/cityhunteur/weather-service/api/v1"
+	"github.com/cityhunteur/weather-service/internal/handler"
+	"github.com/cityhunteur/weather-service/internal/handler/mocks"
+	"github.com/cityhunteur/weather-service/internal/usage"
+)
+
+func TestUsageAdminHandler_GetUsage(t *testing.T) {
+	t.Parallel()
+	july30 := time.Date(2023, 7, 30, 0, 0, 0, 0, time.UTC)
+	july31 := time.Date(2023, 7, 31, 0, 0, 0, 0, time.UTC)
+	daily := []usage.DailyUsage{
+		{Consumer: "dashboard", Day: july31, Counters: usage.Counters{Requests: 1, Cities: 1, CacheHits: 1}},
+		{Consumer: "mobile-app", Day: july30, Counters: usage.Counters{Requests: 2, Cities: 4, CacheHits: 2, UpstreamCalls: 5}},
+		{Consumer: "mobile-app", Day: july31, Counters: usage.Counters{Requests: 1, Cities: 1, UpstreamCalls: 2}},
+	}
+
+	tests := []struct {
+		name           string
+		target         string
+		wantFrom       time.Time
+		wantTo         time.Time
+		wantStatusCode int
+		wantBody       *v1.UsageResponse
+	}{
+		{
+			name:           "invalid date",
+			target:         "/admin/usage?from=yesterday",
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "consumer",
+			target:         "/admin/usage?from=2023-07-30&to=2023-07-31&consumer=mobile-app",
+			wantFrom:       july30,
+			wantTo:         july31,
+			wantStatusCode: http.StatusOK,
+			wantBody: &v1.UsageResponse{
+				From: "2023-07-30",
+				To:   "2023-07-31",
+				Consumers: []*v1.ConsumerUsage{
+					{
+						Consumer: "mobile-app",
+						Total:    v1.UsageCounters{Requests: 3, Cities: 5, CacheHits: 2, UpstreamCalls: 7},
+						Days: []*v1.DailyUsage{
+							{Date: "2023-07-30", UsageCounters: v1.UsageCounters{Requests: 2, Cities: 4, CacheHits: 2, UpstreamCalls: 5}},
+							{Date: "2023-07-31", UsageCounters: v1.UsageCounters{Requests: 1, Cities: 1, UpstreamCalls: 2}},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:           "all consumers",
+			target:         "/admin/usage?from=2023-07-31&to=2023-07-31",
+			wantFrom:       july31,
+			wantTo:         july31,
+			wantStatusCode: http.StatusOK,
+			wantBody: &v1.UsageResponse{
+				From: "2023-07-31",
+				To:   "2023-07-31",
+				Consumers: []*v1.ConsumerUsage{
+					{
+						Consumer: "dashboard",
+						Total:    v1.UsageCounters{Requests: 1, Cities: 1, CacheHits: 1},
+						Days:     []*v1.DailyUsage{{Date: "2023-07-31", UsageCounters: v1.UsageCounters{Requests: 1, Cities: 1, CacheHits: 1}}},
+					},
+					{
+						Consumer: "mobile-app",
+						Total:    v1.UsageCounters{Requests: 1, Cities: 1, UpstreamCalls: 2},
+						Days:     []*v1.DailyUsage{{Date: "2023-07-31", UsageCounters: v1.UsageCounters{Requests: 1, Cities: 1, UpstreamCalls: 2}}},
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			report := mocks.NewUsageReport(t)
+			if tt.wantBody != nil {
+				var matching []usage.DailyUsage
+				for _, u := range daily {
+					if !u.Day.Before(tt.wantFrom) && !u.Day.After(tt.wantTo) {
+						matching = append(matching, u)
+					}
+				}
+				report.On("Usage", tt.wantFrom, tt.wantTo).Return(matching).Once()
+			}
+			h := handler.NewUsageAdminHandler(report)
+
+			resp := httptest.NewRecorder()
+			_, router := gin.CreateTestContext(resp)
+			h.RegisterRoutes(router.Group("/admin"))
+			req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, tt.target, nil)
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.wantStatusCode, resp.Code)
+			if tt.wantBody != nil {
+				var got v1.UsageResponse
+				assert.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+				assert.Equal(t, tt.wantBody, &got)
+			}
+		})
+	}
+}
+
+func TestUsageAdminHandler_GetUsage_CurrentMonth(t *testing.T) {
+	t.Parallel()
+	report := mocks.NewUsageReport(t)
+	report.On("Usage", mock.Anything, mock.Anything).Return(nil).Once()
+	h := handler.NewUsageAdminHandler(report)
+
+	resp := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(resp)
+	h.RegisterRoutes(router.Group("/admin"))
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/admin/usage", nil)
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var got v1.UsageResponse
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	today := time.Now().UTC()
+	assert.Equal(t, today.Format("2006-01")+"-01", got.From)
+	assert.Equal(t, today.Format("2006-01-02"), got.To)
+	assert.Empty(t, got.Consumers)
+}
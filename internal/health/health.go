@@ -0,0 +1,119 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	v1 "github.com/cityhunteur/weather-service/api/v1"
+)
+
+// defaultCheckTimeout bounds the duration of each check.
+const defaultCheckTimeout = 2 * time.Second
+
+// CheckFunc checks a dependency, returning an error if it is unhealthy.
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name     string
+	fn       CheckFunc
+	critical bool
+}
+
+// Checker serves the liveness and readiness of the service.
+type Checker struct {
+	checks   []check
+	draining atomic.Bool
+	timeout  time.Duration
+
+	mu sync.Mutex
+}
+
+// NewChecker creates a new Checker.
+func NewChecker() *Checker {
+	return &Checker{timeout: defaultCheckTimeout}
+}
+
+// AddCheck adds a named check of a dependency to the readiness of the
+// service. The service is not ready while a critical check fails, and only
+// degraded while a non-critical check fails.
+func (h *Checker) AddCheck(name string, fn CheckFunc, critical bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, check{name: name, fn: fn, critical: critical})
+}
+
+// Drain marks the service as not ready, so that load balancers stop routing
+// traffic to it before it shuts down.
+func (h *Checker) Drain() {
+	h.draining.Store(true)
+}
+
+// Liveness responds with 200 as long as the service is able to serve
+// requests.
+func (h *Checker) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, &v1.HealthResponse{Status: v1.HealthStatusOK})
+}
+
+// Readiness runs the checks concurrently and responds with their results,
+// with 503 if the service is draining or a critical check fails.
+func (h *Checker) Readiness(c *gin.Context) {
+	h.mu.Lock()
+	checks := h.checks
+	h.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeout)
+	defer cancel()
+
+	results := make([]*v1.HealthCheck, len(checks))
+	var wg sync.WaitGroup
+	for i, chk := range checks {
+		i, chk := i, chk
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := &v1.HealthCheck{Status: v1.HealthStatusOK, Critical: chk.critical}
+			if err := chk.fn(ctx); err != nil {
+				result.Status = v1.HealthStatusFailing
+				result.Error = err.Error()
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+
+	resp := &v1.HealthResponse{
+		Status: v1.HealthStatusOK,
+		Checks: make(map[string]*v1.HealthCheck, len(checks)),
+	}
+	for i, chk := range checks {
+		resp.Checks[chk.name] = results[i]
+		if results[i].Status == v1.HealthStatusOK {
+			continue
+		}
+		if chk.critical {
+			resp.Status = v1.HealthStatusFailing
+		} else if resp.Status == v1.HealthStatusOK {
+			resp.Status = v1.HealthStatusDegraded
+		}
+	}
+	if h.draining.Load() {
+		resp.Status = v1.HealthStatusDraining
+	}
+
+	status := http.StatusOK
+	if resp.Status == v1.HealthStatusFailing || resp.Status == v1.HealthStatusDraining {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, resp)
+}
+
+// RegisterRoutes registers the liveness and readiness endpoints on r.
+func (h *Checker) RegisterRoutes(r gin.IRoutes) {
+	r.GET("/healthz", h.Liveness)
+	r.GET("/readyz", h.Readiness)
+}
@@ -0,0 +1,103 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/cityhunteur/weather-service/api/v1"
+	"github.com/cityhunteur/weather-service/internal/health"
+)
+
+func TestChecker_Readiness(t *testing.T) {
+	t.Parallel()
+	healthy := func(context.Context) error { return nil }
+	failing := func(context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		name           string
+		cache          health.CheckFunc
+		upstream       health.CheckFunc
+		drain          bool
+		wantStatusCode int
+		wantStatus     string
+	}{
+		{
+			name:           "ready",
+			cache:          healthy,
+			upstream:       healthy,
+			wantStatusCode: http.StatusOK,
+			wantStatus:     v1.HealthStatusOK,
+		},
+		{
+			name:           "upstream failing",
+			cache:          healthy,
+			upstream:       failing,
+			wantStatusCode: http.StatusOK,
+			wantStatus:     v1.HealthStatusDegraded,
+		},
+		{
+			name:           "cache failing",
+			cache:          failing,
+			upstream:       failing,
+			wantStatusCode: http.StatusServiceUnavailable,
+			wantStatus:     v1.HealthStatusFailing,
+		},
+		{
+			name:           "draining",
+			cache:          healthy,
+			upstream:       healthy,
+			drain:          true,
+			wantStatusCode: http.StatusServiceUnavailable,
+			wantStatus:     v1.HealthStatusDraining,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			checker := health.NewChecker()
+			checker.AddCheck("cache", tt.cache, true)
+			checker.AddCheck("weathergov", tt.upstream, false)
+			if tt.drain {
+				checker.Drain()
+			}
+
+			resp := httptest.NewRecorder()
+			_, router := gin.CreateTestContext(resp)
+			checker.RegisterRoutes(router)
+			req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/readyz", nil)
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.wantStatusCode, resp.Code)
+			var got v1.HealthResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+			assert.Equal(t, tt.wantStatus, got.Status)
+			require.Len(t, got.Checks, 2)
+			assert.True(t, got.Checks["cache"].Critical)
+			assert.False(t, got.Checks["weathergov"].Critical)
+		})
+	}
+}
+
+func TestChecker_Liveness(t *testing.T) {
+	t.Parallel()
+	checker := health.NewChecker()
+	checker.AddCheck("cache", func(context.Context) error { return errors.New("connection refused") }, true)
+	checker.Drain()
+
+	resp := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(resp)
+	checker.RegisterRoutes(router)
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/healthz", nil)
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
@@ -0,0 +1,98 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultFailureThreshold is the number of consecutive failed calls after
+	// which an upstream is unhealthy.
+	defaultFailureThreshold = 3
+	// defaultRecentWindow is the duration after its last failure during which
+	// an upstream is considered unhealthy.
+	defaultRecentWindow = time.Minute
+)
+
+// Upstream tracks the recent health of an upstream API from the outcome of
+// the calls made to it.
+type Upstream struct {
+	name string
+
+	failures    int
+	lastFailure time.Time
+	lastErr     string
+
+	threshold int
+	window    time.Duration
+	now       func() time.Time
+
+	mu sync.Mutex
+}
+
+// NewUpstream creates a new Upstream with the given name.
+func NewUpstream(name string) *Upstream {
+	return &Upstream{
+		name:      name,
+		threshold: defaultFailureThreshold,
+		window:    defaultRecentWindow,
+		now:       time.Now,
+	}
+}
+
+// Transport returns base, or http.DefaultTransport if nil, recording the
+// outcome of each call. Transport errors and 5xx responses count as failures.
+func (u *Upstream) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := base.RoundTrip(req)
+		switch {
+		case err != nil:
+			// calls cancelled by the caller say nothing about the upstream
+			if req.Context().Err() == nil {
+				u.recordFailure(err.Error())
+			}
+		case resp.StatusCode >= http.StatusInternalServerError:
+			u.recordFailure(resp.Status)
+		default:
+			u.recordSuccess()
+		}
+		return resp, err
+	})
+}
+
+// Check returns an error if the recent calls to the upstream failed.
+func (u *Upstream) Check(_ context.Context) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.failures < u.threshold || u.now().Sub(u.lastFailure) > u.window {
+		return nil
+	}
+	return fmt.Errorf("%s: %d consecutive failed calls, last: %s", u.name, u.failures, u.lastErr)
+}
+
+func (u *Upstream) recordFailure(reason string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.failures++
+	u.lastFailure = u.now()
+	u.lastErr = reason
+}
+
+func (u *Upstream) recordSuccess() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.failures = 0
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,62 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpstream(t *testing.T) {
+	t.Parallel()
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	u := NewUpstream("weathergov")
+	u.now = func() time.Time { return now }
+	client := &http.Client{Transport: u.Transport(nil)}
+	call := func() {
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+	}
+
+	call()
+	assert.NoError(t, u.Check(context.Background()))
+
+	// client errors say nothing about the upstream
+	status = http.StatusNotFound
+	for i := 0; i < defaultFailureThreshold; i++ {
+		call()
+	}
+	assert.NoError(t, u.Check(context.Background()))
+
+	// unhealthy after consecutive server errors
+	status = http.StatusServiceUnavailable
+	for i := 0; i < defaultFailureThreshold; i++ {
+		assert.NoError(t, u.Check(context.Background()))
+		call()
+	}
+	assert.ErrorContains(t, u.Check(context.Background()), "503")
+
+	// failures are forgotten once they are no longer recent
+	now = now.Add(defaultRecentWindow + time.Second)
+	assert.NoError(t, u.Check(context.Background()))
+
+	// and as soon as a call succeeds
+	now = now.Add(-defaultRecentWindow)
+	assert.Error(t, u.Check(context.Background()))
+	status = http.StatusOK
+	call()
+	assert.NoError(t, u.Check(context.Background()))
+}
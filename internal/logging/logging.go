@@ -0,0 +1,137 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader is the header carrying the ID of a request.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the length of request IDs accepted from clients.
+const maxRequestIDLength = 128
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestIDKey
+)
+
+// NewContext returns a copy of ctx carrying logger.
+func NewContext(ctx context.Context, logger *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext returns the logger carried by ctx, or fallback if none.
+func FromContext(ctx context.Context, fallback *zap.SugaredLogger) *zap.SugaredLogger {
+	if logger, ok := ctx.Value(loggerKey).(*zap.SugaredLogger); ok {
+		return logger
+	}
+	return fallback
+}
+
+// RequestID returns the ID of the request carried by ctx, if any.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// Middleware returns a gin middleware which assigns an ID to each request, or
+// propagates the valid ID sent by the client in the X-Request-ID header, and
+// echoes it in the response. The request context carries a logger including
+// the request ID, and the trace ID if the request is traced. Each request is
+// logged once handled.
+func Middleware(logger *zap.SugaredLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+
+		reqLogger := logger.With("request_id", id)
+		if sc := trace.SpanContextFromContext(c.Request.Context()); sc.HasTraceID() {
+			reqLogger = reqLogger.With("trace_id", sc.TraceID().String())
+		}
+		ctx := context.WithValue(c.Request.Context(), requestIDKey, id)
+		c.Request = c.Request.WithContext(NewContext(ctx, reqLogger))
+
+		c.Next()
+
+		// handlers may have enriched the logger, e.g. with the consumer
+		reqLogger = FromContext(c.Request.Context(), reqLogger)
+		route := c.FullPath()
+		status := c.Writer.Status()
+		fields := []any{
+			"method", c.Request.Method,
+			"route", route,
+			"path", c.Request.URL.Path,
+			"status", status,
+			"latency", time.Since(start),
+			"client_ip", c.ClientIP(),
+		}
+		if cities := c.Query("city"); cities != "" {
+			fields = append(fields, "cities", cities)
+		}
+		if errs := c.Errors.ByType(gin.ErrorTypePrivate).String(); errs != "" {
+			fields = append(fields, "errors", errs)
+		}
+
+		switch {
+		case status >= http.StatusInternalServerError:
+			reqLogger.Errorw("Handled request", fields...)
+		case status >= http.StatusBadRequest:
+			reqLogger.Warnw("Handled request", fields...)
+		default:
+			reqLogger.Infow("Handled request", fields...)
+		}
+	}
+}
+
+// Recovery returns a gin middleware which recovers from panics in handlers,
+// logging them with the request logger and responding with a 500.
+func Recovery(logger *zap.SugaredLogger) gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+		FromContext(c.Request.Context(), logger).Errorw("Recovered from panic",
+			"error", err,
+			"stack", string(debug.Stack()),
+		)
+		c.AbortWithStatus(http.StatusInternalServerError)
+	})
+}
+
+// validRequestID reports whether id is a non-empty request ID of printable
+// ASCII characters, short enough to be logged.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random request ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
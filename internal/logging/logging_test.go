@@ -0,0 +1,121 @@
+package logging_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/cityhunteur/weather-service/internal/logging"
+)
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		requestID     string
+		target        string
+		wantRequestID string
+		wantStatus    int
+		wantLevel     zapcore.Level
+	}{
+		{
+			name:          "propagates request id",
+			requestID:     "3f2a9c1e-7b1d-4d0e-9a4f-0b6e2c8d5a11",
+			target:        "/v1/weather?city=chicago",
+			wantRequestID: "3f2a9c1e-7b1d-4d0e-9a4f-0b6e2c8d5a11",
+			wantStatus:    http.StatusOK,
+			wantLevel:     zapcore.InfoLevel,
+		},
+		{
+			name:       "assigns request id",
+			target:     "/v1/weather?city=chicago",
+			wantStatus: http.StatusOK,
+			wantLevel:  zapcore.InfoLevel,
+		},
+		{
+			name:       "replaces invalid request id",
+			requestID:  "bad id\n",
+			target:     "/v1/weather?city=chicago",
+			wantStatus: http.StatusOK,
+			wantLevel:  zapcore.InfoLevel,
+		},
+		{
+			name:       "replaces overlong request id",
+			requestID:  strings.Repeat("a", 129),
+			target:     "/v1/weather?city=chicago",
+			wantStatus: http.StatusOK,
+			wantLevel:  zapcore.InfoLevel,
+		},
+		{
+			name:       "logs client errors as warnings",
+			target:     "/v1/weather",
+			wantStatus: http.StatusBadRequest,
+			wantLevel:  zapcore.WarnLevel,
+		},
+		{
+			name:       "logs panics as errors",
+			target:     "/panic",
+			wantStatus: http.StatusInternalServerError,
+			wantLevel:  zapcore.ErrorLevel,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			core, logs := observer.New(zapcore.DebugLevel)
+			logger := zap.New(core).Sugar()
+
+			_, router := gin.CreateTestContext(httptest.NewRecorder())
+			router.Use(logging.Middleware(logger), logging.Recovery(logger))
+			router.GET("/v1/weather", func(c *gin.Context) {
+				if c.Query("city") == "" {
+					c.Status(http.StatusBadRequest)
+					return
+				}
+				logging.FromContext(c.Request.Context(), logger).Infow("Getting forecasts")
+				c.String(http.StatusOK, logging.RequestID(c.Request.Context()))
+			})
+			router.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+			resp := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.requestID != "" {
+				req.Header.Set(logging.RequestIDHeader, tt.requestID)
+			}
+			router.ServeHTTP(resp, req)
+
+			require.Equal(t, tt.wantStatus, resp.Code)
+			requestID := resp.Header().Get(logging.RequestIDHeader)
+			if tt.wantRequestID != "" {
+				assert.Equal(t, tt.wantRequestID, requestID)
+			} else {
+				assert.Len(t, requestID, 32)
+			}
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, requestID, resp.Body.String())
+			}
+
+			// every line logged during the request includes its id
+			for _, entry := range logs.All() {
+				assert.Equal(t, requestID, entry.ContextMap()["request_id"], entry.Message)
+			}
+			access := logs.FilterMessage("Handled request").All()
+			require.Len(t, access, 1)
+			assert.Equal(t, tt.wantLevel, access[0].Level)
+			fields := access[0].ContextMap()
+			assert.Equal(t, http.MethodGet, fields["method"])
+			assert.Equal(t, int64(tt.wantStatus), fields["status"])
+			assert.Contains(t, fields, "latency")
+			assert.Contains(t, fields, "client_ip")
+		})
+	}
+}
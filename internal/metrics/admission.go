@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"github.com/cityhunteur/weather-service/internal/admission"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	admissionLimitDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "admission", "limit"),
+		"Number of requests allowed to call upstream APIs concurrently.",
+		nil, nil,
+	)
+	admissionInFlightDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "admission", "in_flight"),
+		"Number of admitted requests calling upstream APIs.",
+		nil, nil,
+	)
+	admissionQueuedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "admission", "queued"),
+		"Number of requests waiting to be admitted.",
+		nil, nil,
+	)
+	admissionRejectedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "admission", "rejected_total"),
+		"Number of requests shed.",
+		nil, nil,
+	)
+)
+
+// AdmissionStatsProvider is an admission limiter reporting its state.
+type AdmissionStatsProvider interface {
+	Stats() admission.Stats
+}
+
+// admissionCollector collects the state of an admission limiter when
+// scraped.
+type admissionCollector struct {
+	limiter AdmissionStatsProvider
+}
+
+// RegisterAdmission collects the state of the admission limiter l. It must be
+// called at most once.
+func (m *Metrics) RegisterAdmission(l AdmissionStatsProvider) {
+	m.registry.MustRegister(&admissionCollector{limiter: l})
+}
+
+func (c *admissionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- admissionLimitDesc
+	ch <- admissionInFlightDesc
+	ch <- admissionQueuedDesc
+	ch <- admissionRejectedDesc
+}
+
+func (c *admissionCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.limiter.Stats()
+	ch <- prometheus.MustNewConstMetric(admissionLimitDesc, prometheus.GaugeValue, float64(stats.Limit))
+	ch <- prometheus.MustNewConstMetric(admissionInFlightDesc, prometheus.GaugeValue, float64(stats.InFlight))
+	ch <- prometheus.MustNewConstMetric(admissionQueuedDesc, prometheus.GaugeValue, float64(stats.Queued))
+	ch <- prometheus.MustNewConstMetric(admissionRejectedDesc, prometheus.CounterValue, float64(stats.Rejected))
+}
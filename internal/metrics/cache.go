@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/cityhunteur/weather-service/internal/cache"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	cacheHitsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cache", "hits_total"),
+		"Number of cache lookups which found a fresh entry.",
+		[]string{"cache"}, nil,
+	)
+	cacheMissesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cache", "misses_total"),
+		"Number of cache lookups which found no fresh entry.",
+		[]string{"cache"}, nil,
+	)
+	cacheEvictionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cache", "evictions_total"),
+		"Number of entries evicted to bound the size of the cache.",
+		[]string{"cache"}, nil,
+	)
+	cacheExpirationsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cache", "expirations_total"),
+		"Number of expired entries purged from the cache.",
+		[]string{"cache"}, nil,
+	)
+	cacheEntriesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cache", "entries"),
+		"Number of entries in the cache.",
+		[]string{"cache"}, nil,
+	)
+	cacheBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cache", "bytes"),
+		"Estimated number of bytes held by the cache.",
+		[]string{"cache"}, nil,
+	)
+)
+
+// StatsProvider is a cache reporting its counters.
+type StatsProvider interface {
+	Stats() cache.Stats
+}
+
+// cacheCollector collects the counters of caches by name when scraped.
+type cacheCollector struct {
+	caches map[string]StatsProvider
+
+	mu sync.Mutex
+}
+
+func newCacheCollector() *cacheCollector {
+	return &cacheCollector{caches: make(map[string]StatsProvider)}
+}
+
+// RegisterCache collects the counters of c, labelled with name. Registering
+// another cache with the same name replaces it.
+func (m *Metrics) RegisterCache(name string, c StatsProvider) {
+	m.caches.mu.Lock()
+	defer m.caches.mu.Unlock()
+	m.caches.caches[name] = c
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheHitsDesc
+	ch <- cacheMissesDesc
+	ch <- cacheEvictionsDesc
+	ch <- cacheExpirationsDesc
+	ch <- cacheEntriesDesc
+	ch <- cacheBytesDesc
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name, provider := range c.caches {
+		c.collect(ch, name, provider.Stats())
+	}
+}
+
+func (c *cacheCollector) collect(ch chan<- prometheus.Metric, name string, stats cache.Stats) {
+	ch <- prometheus.MustNewConstMetric(cacheHitsDesc, prometheus.CounterValue, float64(stats.Hits), name)
+	ch <- prometheus.MustNewConstMetric(cacheMissesDesc, prometheus.CounterValue, float64(stats.Misses), name)
+	ch <- prometheus.MustNewConstMetric(cacheEvictionsDesc, prometheus.CounterValue, float64(stats.Evictions), name)
+	ch <- prometheus.MustNewConstMetric(cacheExpirationsDesc, prometheus.CounterValue, float64(stats.Expirations), name)
+	ch <- prometheus.MustNewConstMetric(cacheEntriesDesc, prometheus.GaugeValue, float64(stats.Entries), name)
+	ch <- prometheus.MustNewConstMetric(cacheBytesDesc, prometheus.GaugeValue, float64(stats.Bytes), name)
+}
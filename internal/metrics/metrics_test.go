@@ -0,0 +1,116 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cityhunteur/weather-service/internal/admission"
+	"github.com/cityhunteur/weather-service/internal/cache"
+	"github.com/cityhunteur/weather-service/internal/metrics"
+	"github.com/cityhunteur/weather-service/internal/pkg/openstreetmap"
+)
+
+type fakeOpenStreetMap struct {
+	err error
+}
+
+func (f *fakeOpenStreetMap) GetPlace(_ context.Context, _ *openstreetmap.GetOptions) ([]*openstreetmap.Place, error) {
+	return nil, f.err
+}
+
+// scrape returns the metrics exposed by m.
+func scrape(t *testing.T, m *metrics.Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+func TestMetrics_Middleware(t *testing.T) {
+	t.Parallel()
+	gin.SetMode(gin.TestMode)
+
+	m := metrics.New()
+	router := gin.New()
+	router.Use(m.Middleware())
+	router.GET("/v1/weather", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, target := range []string{"/v1/weather?city=chicago", "/v1/weather", "/unknown"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	}
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `weather_service_http_requests_total{method="GET",route="/v1/weather",status="200"} 2`)
+	assert.Contains(t, body, `weather_service_http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, body, `weather_service_http_request_duration_seconds_count{method="GET",route="/v1/weather",status="200"} 2`)
+	assert.Contains(t, body, `weather_service_http_requests_in_flight 0`)
+}
+
+func TestMetrics_InstrumentOpenStreetMap(t *testing.T) {
+	t.Parallel()
+
+	m := metrics.New()
+	osm := &fakeOpenStreetMap{}
+	api := m.InstrumentOpenStreetMap(osm)
+
+	_, err := api.GetPlace(context.Background(), &openstreetmap.GetOptions{})
+	require.NoError(t, err)
+	osm.err = errors.New("boom")
+	_, err = api.GetPlace(context.Background(), &openstreetmap.GetOptions{})
+	require.Error(t, err)
+
+	body := scrape(t, m)
+	assert.Contains(t, body, `weather_service_upstream_request_duration_seconds_count{client="openstreetmap",method="GetPlace"} 2`)
+	assert.Contains(t, body, `weather_service_upstream_errors_total{client="openstreetmap",method="GetPlace"} 1`)
+}
+
+func TestMetrics_RegisterCache(t *testing.T) {
+	t.Parallel()
+
+	m := metrics.New()
+	forecasts := cache.NewStore[string, int]()
+	forecasts.Set("OKX/33,35", 1, 0)
+	forecasts.Get("OKX/33,35")
+	forecasts.Get("LOX/154,44")
+	m.RegisterCache("forecast", forecasts)
+	m.RegisterCache("alias", cache.NewStore[string, string]())
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		`weather_service_cache_hits_total{cache="forecast"} 1`,
+		`weather_service_cache_misses_total{cache="forecast"} 1`,
+		`weather_service_cache_entries{cache="forecast"} 1`,
+		`weather_service_cache_entries{cache="alias"} 0`,
+	} {
+		assert.Contains(t, body, want)
+	}
+}
+
+func TestMetrics_RegisterAdmission(t *testing.T) {
+	t.Parallel()
+
+	m := metrics.New()
+	limiter := admission.New(admission.WithLimits(2, 1, 4), admission.WithQueue(0, 0))
+	release, err := limiter.Acquire(context.Background())
+	require.NoError(t, err)
+	defer release()
+	m.RegisterAdmission(limiter)
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		`weather_service_admission_limit 2`,
+		`weather_service_admission_in_flight 1`,
+		`weather_service_admission_queued 0`,
+		`weather_service_admission_rejected_total 0`,
+	} {
+		assert.Contains(t, body, want)
+	}
+}
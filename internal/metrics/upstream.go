@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/cityhunteur/weather-service/internal/pkg/openstreetmap"
+	"github.com/cityhunteur/weather-service/internal/pkg/weathergov"
+)
+
+// OpenStreetMapAPI is the openstreetmap API used by the service.
+type OpenStreetMapAPI interface {
+	GetPlace(ctx context.Context, opts *openstreetmap.GetOptions) ([]*openstreetmap.Place, error)
+}
+
+// WeatherGovAPI is the weather.gov API used by the service.
+type WeatherGovAPI interface {
+	GetPoints(ctx context.Context, coord *weathergov.Coordinates) (*weathergov.Points, error)
+	GetForecast(ctx context.Context, forecastURL string) (*weathergov.Forecast, error)
+}
+
+type openStreetMapAPI struct {
+	api     OpenStreetMapAPI
+	metrics *Metrics
+}
+
+// InstrumentOpenStreetMap returns api recording the latency and errors of
+// its calls.
+func (m *Metrics) InstrumentOpenStreetMap(api OpenStreetMapAPI) OpenStreetMapAPI {
+	return &openStreetMapAPI{api: api, metrics: m}
+}
+
+func (c *openStreetMapAPI) GetPlace(ctx context.Context, opts *openstreetmap.GetOptions) ([]*openstreetmap.Place, error) {
+	start := time.Now()
+	places, err := c.api.GetPlace(ctx, opts)
+	c.metrics.observeUpstream("openstreetmap", "GetPlace", start, err)
+	return places, err
+}
+
+type weatherGovAPI struct {
+	api     WeatherGovAPI
+	metrics *Metrics
+}
+
+// InstrumentWeatherGov returns api recording the latency and errors of its
+// calls.
+func (m *Metrics) InstrumentWeatherGov(api WeatherGovAPI) WeatherGovAPI {
+	return &weatherGovAPI{api: api, metrics: m}
+}
+
+func (c *weatherGovAPI) GetPoints(ctx context.Context, coord *weathergov.Coordinates) (*weathergov.Points, error) {
+	start := time.Now()
+	points, err := c.api.GetPoints(ctx, coord)
+	c.metrics.observeUpstream("weathergov", "GetPoints", start, err)
+	return points, err
+}
+
+func (c *weatherGovAPI) GetForecast(ctx context.Context, forecastURL string) (*weathergov.Forecast, error) {
+	start := time.Now()
+	forecast, err := c.api.GetForecast(ctx, forecastURL)
+	c.metrics.observeUpstream("weathergov", "GetForecast", start, err)
+	return forecast, err
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/google/go-querystring/query"
 )
@@ -21,17 +22,36 @@ type Client struct {
 	baseURL *url.URL
 }
 
+// Option configures a Client.
+type Option func(c *Client)
+
+// WithBaseURL configures the client to send requests to the API served at u,
+// e.g. a self-hosted instance, instead of the public API.
+func WithBaseURL(u *url.URL) Option {
+	return func(c *Client) {
+		baseURL := *u
+		if !strings.HasSuffix(baseURL.Path, "/") {
+			baseURL.Path += "/"
+		}
+		c.baseURL = &baseURL
+	}
+}
+
 // NewClient creates a new Client using the given http client if provided.
-func NewClient(httpClient *http.Client) *Client {
+func NewClient(httpClient *http.Client, opts ...Option) *Client {
 	if httpClient == nil {
 		httpClient = &http.Client{}
 	}
 	baseURL, _ := url.Parse(defaultBaseURL)
 
-	return &Client{
+	c := &Client{
 		client:  httpClient,
 		baseURL: baseURL,
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // GetOptions specifies the parameters to query on.
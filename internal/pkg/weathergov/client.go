@@ -4,12 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"time"
 )
 
 const (
 	defaultBaseURL = "https://api.weather.gov/"
+
+	// maxValidators bounds the number of responses kept for revalidation.
+	maxValidators = 1000
 )
 
 // Client is a Weather Gov API client.
@@ -17,19 +24,50 @@ type Client struct {
 	client *http.Client
 
 	baseURL *url.URL
+
+	mu         sync.Mutex
+	validators map[string]*validator
+}
+
+// validator holds the validators and body of a previous response, used to
+// revalidate the resource with a conditional request.
+type validator struct {
+	etag         string
+	lastModified string
+	body         []byte
+}
+
+// Option configures a Client.
+type Option func(c *Client)
+
+// WithBaseURL configures the client to send requests to the API served at u,
+// e.g. a self-hosted instance, instead of the public API.
+func WithBaseURL(u *url.URL) Option {
+	return func(c *Client) {
+		baseURL := *u
+		if !strings.HasSuffix(baseURL.Path, "/") {
+			baseURL.Path += "/"
+		}
+		c.baseURL = &baseURL
+	}
 }
 
 // NewClient creates a new Client using the given http client if provided.
-func NewClient(httpClient *http.Client) *Client {
+func NewClient(httpClient *http.Client, opts ...Option) *Client {
 	if httpClient == nil {
 		httpClient = &http.Client{}
 	}
 	baseURL, _ := url.Parse(defaultBaseURL)
 
-	return &Client{
-		client:  httpClient,
-		baseURL: baseURL,
+	c := &Client{
+		client:     httpClient,
+		baseURL:    baseURL,
+		validators: make(map[string]*validator),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
 }
 
 // Coordinates represents the geo coordinates of a place.
@@ -48,7 +86,7 @@ func (c *Client) GetPoints(ctx context.Context, coord *Coordinates) (*Points, er
 	}
 
 	var p Points
-	err = c.doRequest(ctx, req, &p)
+	p.Expires, err = c.doRequest(ctx, req, &p)
 	if err != nil {
 		return nil, fmt.Errorf("calling api to get points: %w", err)
 	}
@@ -64,7 +102,7 @@ func (c *Client) GetForecast(ctx context.Context, forecastURL string) (*Forecast
 	}
 
 	var f Forecast
-	err = c.doRequest(ctx, req, &f)
+	f.Expires, err = c.doRequest(ctx, req, &f)
 	if err != nil {
 		return nil, fmt.Errorf("calling api to get forecast: %w", err)
 	}
@@ -86,22 +124,90 @@ func (c *Client) newRequest(ctx context.Context, method, urlStr string) (*http.R
 	return req, nil
 }
 
-func (c *Client) doRequest(ctx context.Context, req *http.Request, v interface{}) error {
+// doRequest sends the request and decodes the response body into v. Requests
+// are made conditional when a previous response for the same URL carried
+// validators, in which case a 304 Not Modified reuses the previous body. It
+// returns the time at which the response becomes stale, or the zero time if
+// the response carries no freshness information.
+func (c *Client) doRequest(ctx context.Context, req *http.Request, v interface{}) (time.Time, error) {
+	key := req.URL.String()
+
+	c.mu.Lock()
+	prev := c.validators[key]
+	c.mu.Unlock()
+	if prev != nil {
+		if prev.etag != "" {
+			req.Header.Set("If-None-Match", prev.etag)
+		}
+		if prev.lastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.lastModified)
+		}
+	}
+
 	resp, err := c.client.Do(req)
 	if err != nil {
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return time.Time{}, ctx.Err()
 		default:
 		}
-		return fmt.Errorf("sending http request: %w", err)
+		return time.Time{}, fmt.Errorf("sending http request: %w", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
-	err = json.NewDecoder(resp.Body).Decode(v)
+	var body []byte
+	if resp.StatusCode == http.StatusNotModified && prev != nil {
+		body = prev.body
+	} else {
+		if err := checkResponse(resp); err != nil {
+			return time.Time{}, fmt.Errorf("http error response: %w", err)
+		}
+		body, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("reading response body: %w", err)
+		}
+		c.storeValidator(key, resp.Header, body)
+	}
+
+	err = json.Unmarshal(body, v)
 	if err != nil {
-		return fmt.Errorf("decoding json response: %w", err)
+		return time.Time{}, fmt.Errorf("decoding json response: %w", err)
+	}
+
+	return expiresAt(resp.Header, time.Now()), nil
+}
+
+// storeValidator keeps the validators of a response so that later requests
+// for the same URL can be made conditional.
+func (c *Client) storeValidator(key string, h http.Header, body []byte) {
+	etag, lastModified := h.Get("ETag"), h.Get("Last-Modified")
+	_, noStore := parseCacheControl(h)["no-store"]
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if noStore || (etag == "" && lastModified == "") {
+		delete(c.validators, key)
+		return
+	}
+	if _, found := c.validators[key]; !found && len(c.validators) >= maxValidators {
+		// evict an arbitrary entry; forecast URLs are stable per grid point,
+		// so the set of keys is small in practice
+		for k := range c.validators {
+			delete(c.validators, k)
+			break
+		}
 	}
+	c.validators[key] = &validator{
+		etag:         etag,
+		lastModified: lastModified,
+		body:         body,
+	}
+}
 
-	return nil
+func checkResponse(r *http.Response) error {
+	if c := r.StatusCode; 200 <= c && c <= 299 {
+		return nil
+	}
+	return fmt.Errorf("unexpected http status code: %d", r.StatusCode)
 }
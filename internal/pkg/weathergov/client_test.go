@@ -0,0 +1,123 @@
+package weathergov
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const forecastBody = `{"properties":{"periods":[{"name":"Tonight","isDaytime":false,"detailedForecast":"Clear."}]}}`
+
+func newTestClient(t *testing.T, h http.Handler) *Client {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	baseURL, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	return NewClient(srv.Client(), WithBaseURL(baseURL))
+}
+
+func TestClient_GetForecast_ConditionalRequest(t *testing.T) {
+	t.Parallel()
+	const etag = `"abc123"`
+	const lastModified = "Thu, 29 Jun 2023 21:00:00 GMT"
+	var requests, notModified int
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", "public, max-age=600")
+		if r.Header.Get("If-None-Match") == etag && r.Header.Get("If-Modified-Since") == lastModified {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		_, _ = fmt.Fprint(w, forecastBody)
+	}))
+
+	for i := 0; i < 2; i++ {
+		before := time.Now()
+		f, err := c.GetForecast(context.Background(), "gridpoints/OKX/33,35/forecast")
+		require.NoError(t, err)
+		require.Len(t, f.Properties.Periods, 1)
+		assert.Equal(t, "Clear.", f.Properties.Periods[0].DetailedForecast)
+		assert.WithinDuration(t, before.Add(10*time.Minute), f.Expires, time.Second)
+	}
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, 1, notModified)
+}
+
+func TestClient_GetForecast_ErrorStatus(t *testing.T) {
+	t.Parallel()
+	c := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = fmt.Fprint(w, `{"title":"Unexpected Problem"}`)
+	}))
+
+	_, err := c.GetForecast(context.Background(), "gridpoints/OKX/33,35/forecast")
+	assert.Error(t, err)
+}
+
+func TestExpiresAt(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2023, 6, 29, 21, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Time
+	}{
+		{
+			name:   "no freshness information",
+			header: http.Header{},
+			want:   time.Time{},
+		},
+		{
+			name:   "max-age",
+			header: http.Header{"Cache-Control": {"public, max-age=3600"}},
+			want:   now.Add(time.Hour),
+		},
+		{
+			name:   "max-age minus age",
+			header: http.Header{"Cache-Control": {"max-age=3600"}, "Age": {"600"}},
+			want:   now.Add(50 * time.Minute),
+		},
+		{
+			name:   "s-maxage takes precedence",
+			header: http.Header{"Cache-Control": {"max-age=3600, s-maxage=60"}},
+			want:   now.Add(time.Minute),
+		},
+		{
+			name: "expires relative to date",
+			header: http.Header{
+				"Date":    {"Thu, 29 Jun 2023 20:00:00 GMT"},
+				"Expires": {"Thu, 29 Jun 2023 20:30:00 GMT"},
+			},
+			want: now.Add(30 * time.Minute),
+		},
+		{
+			name:   "no-cache",
+			header: http.Header{"Cache-Control": {"no-cache, max-age=3600"}},
+			want:   time.Time{},
+		},
+		{
+			name:   "invalid expires",
+			header: http.Header{"Expires": {"0"}},
+			want:   time.Time{},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, expiresAt(tt.header, now))
+		})
+	}
+}
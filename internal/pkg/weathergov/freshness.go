@@ -0,0 +1,67 @@
+package weathergov
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// expiresAt returns the time at which a response received at now with the
+// given headers becomes stale, as described in RFC 9111. The freshness
+// lifetime is taken from the s-maxage or max-age directives, falling back to
+// the Expires header relative to Date. A zero time is returned when the
+// response carries no freshness information or must be revalidated before
+// reuse.
+func expiresAt(h http.Header, now time.Time) time.Time {
+	cc := parseCacheControl(h)
+	if _, ok := cc["no-store"]; ok {
+		return time.Time{}
+	}
+	if _, ok := cc["no-cache"]; ok {
+		return time.Time{}
+	}
+
+	var age time.Duration
+	if secs, err := strconv.ParseInt(h.Get("Age"), 10, 64); err == nil && secs > 0 {
+		age = time.Duration(secs) * time.Second
+	}
+
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		v, ok := cc[directive]
+		if !ok {
+			continue
+		}
+		secs, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || secs < 0 {
+			continue
+		}
+		return now.Add(time.Duration(secs)*time.Second - age)
+	}
+
+	expires, err := http.ParseTime(h.Get("Expires"))
+	if err != nil {
+		return time.Time{}
+	}
+	date, err := http.ParseTime(h.Get("Date"))
+	if err != nil {
+		date = now
+	}
+	return now.Add(expires.Sub(date) - age)
+}
+
+// parseCacheControl parses the Cache-Control directives of h into a map of
+// lower-cased directive names to their, possibly empty, values.
+func parseCacheControl(h http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, line := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(line, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if name == "" {
+				continue
+			}
+			directives[strings.ToLower(name)] = strings.Trim(value, `"`)
+		}
+	}
+	return directives
+}
@@ -1,8 +1,15 @@
 package weathergov
 
-import v1 "github.com/cityhunteur/weather-service/api/v1"
+import (
+	"time"
+
+	v1 "github.com/cityhunteur/weather-service/api/v1"
+)
 
 type PointsProperties struct {
+	GridID   string `json:"gridId"`
+	GridX    int    `json:"gridX"`
+	GridY    int    `json:"gridY"`
 	Forecast string `json:"forecast"`
 }
 
@@ -10,6 +17,10 @@ type PointsProperties struct {
 type Points struct {
 	ID         string           `json:"id"`
 	Properties PointsProperties `json:"properties"`
+
+	// Expires is the time at which the response becomes stale, as advertised
+	// by the upstream cache headers. It is zero if unknown.
+	Expires time.Time `json:"-"`
 }
 
 type Periods struct {
@@ -27,4 +38,8 @@ type ForecastProperties struct {
 // Forecast represents the forecast for a given point.
 type Forecast struct {
 	Properties ForecastProperties `json:"properties"`
+
+	// Expires is the time at which the response becomes stale, as advertised
+	// by the upstream cache headers. It is zero if unknown.
+	Expires time.Time `json:"-"`
 }
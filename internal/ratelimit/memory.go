@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store holding the buckets in process, limiting clients per
+// instance of the service.
+type MemoryStore struct {
+	buckets map[string]*memoryBucket
+	now     func() time.Time
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu sync.Mutex
+}
+
+type memoryBucket struct {
+	bucket
+	limit Limit
+}
+
+// NewMemoryStore creates a new MemoryStore. Full buckets, which are the same as
+// missing ones, are removed at every janitorInterval until Close, if positive.
+func NewMemoryStore(janitorInterval time.Duration) *MemoryStore {
+	s := &MemoryStore{
+		buckets: make(map[string]*memoryBucket),
+		now:     time.Now,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	if janitorInterval > 0 {
+		go s.runJanitor(janitorInterval)
+	} else {
+		close(s.done)
+	}
+	return s
+}
+
+// Take takes a token from the bucket of key.
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, found := s.buckets[key]
+	if !found {
+		b = &memoryBucket{bucket: bucket{tokens: float64(limit.Burst), updatedAt: now}}
+		s.buckets[key] = b
+	}
+	b.limit = limit
+	return b.take(now, limit), nil
+}
+
+// Len returns the number of buckets held.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets)
+}
+
+// Close stops the janitor, if any. It is safe to call Close more than once.
+func (s *MemoryStore) Close() {
+	s.closeOnce.Do(func() { close(s.stop) })
+	<-s.done
+}
+
+func (s *MemoryStore) runJanitor(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.purgeFull()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// purgeFull removes the full buckets.
+func (s *MemoryStore) purgeFull() {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, b := range s.buckets {
+		if b.full(now, b.limit) {
+			delete(s.buckets, key)
+		}
+	}
+}
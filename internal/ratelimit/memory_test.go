@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore_Take(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	s := NewMemoryStore(0)
+	s.now = func() time.Time { return now }
+	limit := Per(60, time.Minute, 3)
+
+	// the burst is allowed at once
+	for i := 2; i >= 0; i-- {
+		res, err := s.Take(ctx, "a", limit)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+		assert.Equal(t, time.Duration(3-i)*time.Second, res.Reset)
+	}
+	res, err := s.Take(ctx, "a", limit)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Allowed: false, Remaining: 0, RetryAfter: time.Second, Reset: 3 * time.Second}, res)
+
+	// other keys have their own bucket
+	res, err = s.Take(ctx, "b", limit)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	// tokens are refilled at the rate, up to the burst
+	now = now.Add(1500 * time.Millisecond)
+	res, err = s.Take(ctx, "a", limit)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Allowed: true, Remaining: 0, Reset: 2500 * time.Millisecond}, res)
+	res, err = s.Take(ctx, "a", limit)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Allowed: false, Remaining: 0, RetryAfter: 500 * time.Millisecond, Reset: 2500 * time.Millisecond}, res)
+
+	now = now.Add(time.Hour)
+	res, err = s.Take(ctx, "a", limit)
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Remaining)
+}
+
+func TestMemoryStore_PurgeFull(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	now := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	s := NewMemoryStore(0)
+	s.now = func() time.Time { return now }
+
+	_, _ = s.Take(ctx, "slow", Per(1, time.Minute, 1))
+	_, _ = s.Take(ctx, "fast", Per(60, time.Minute, 1))
+	now = now.Add(time.Second)
+	s.purgeFull()
+	assert.Equal(t, 1, s.Len())
+
+	now = now.Add(time.Minute)
+	s.purgeFull()
+	assert.Equal(t, 0, s.Len())
+}
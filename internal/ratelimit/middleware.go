@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cityhunteur/weather-service/internal/auth"
+	"github.com/cityhunteur/weather-service/internal/logging"
+)
+
+// Headers of the rate limit of a response, as specified by the IETF
+// RateLimit header fields draft.
+const (
+	LimitHeader     = "RateLimit-Limit"
+	RemainingHeader = "RateLimit-Remaining"
+	ResetHeader     = "RateLimit-Reset"
+)
+
+// Limits are the limits of each tier of clients.
+type Limits struct {
+	// Consumer limits each authenticated consumer, e.g. by API key.
+	Consumer Limit
+	// Anonymous limits each client IP of unauthenticated requests.
+	Anonymous Limit
+}
+
+// Limiter limits the rate of requests of each client. Its limits can be
+// changed while serving.
+type Limiter struct {
+	store  Store
+	limits atomic.Pointer[Limits]
+}
+
+// NewLimiter creates a new Limiter keeping the buckets of clients in store.
+func NewLimiter(store Store, limits Limits) *Limiter {
+	l := &Limiter{store: store}
+	l.SetLimits(limits)
+	return l
+}
+
+// SetLimits changes the limits of the tiers. Buckets keep their tokens, up
+// to the new burst.
+func (l *Limiter) SetLimits(limits Limits) {
+	l.limits.Store(&limits)
+}
+
+// Middleware returns a gin middleware rejecting the requests of clients over
+// their limit with a 429 and a Retry-After header. Every response carries the
+// RateLimit-* headers of the bucket of its client. Requests are keyed by the
+// authenticated consumer, so it must come after the authentication
+// middlewares, or else by client IP. Consumers are keyed along with the method
+// they authenticated with, so that an API key and a JWT subject of the same
+// name do not share a bucket. It must come before auth.Required, so that
+// requests with missing or invalid credentials are limited too. Requests are
+// allowed if the store fails.
+func (l *Limiter) Middleware(logger *zap.SugaredLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limits := l.limits.Load()
+		key, limit := "ip:"+c.ClientIP(), limits.Anonymous
+		if id, ok := auth.FromContext(c.Request.Context()); ok {
+			key, limit = "consumer:"+id.Method+":"+id.Name, limits.Consumer
+		}
+
+		res, err := l.store.Take(c.Request.Context(), key, limit)
+		if err != nil {
+			logging.FromContext(c.Request.Context(), logger).Warnw("Failed to rate limit request, allowing it", "error", err)
+			c.Next()
+			return
+		}
+
+		c.Header(LimitHeader, strconv.Itoa(limit.Burst))
+		c.Header(RemainingHeader, strconv.Itoa(res.Remaining))
+		c.Header(ResetHeader, strconv.Itoa(seconds(res.Reset)))
+		if !res.Allowed {
+			c.Header("Retry-After", strconv.Itoa(seconds(res.RetryAfter)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"message": "Too many requests, retry later."})
+			return
+		}
+		c.Next()
+	}
+}
+
+// seconds returns d in seconds, rounded up.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
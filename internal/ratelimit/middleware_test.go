@@ -0,0 +1,168 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/cityhunteur/weather-service/internal/auth"
+	"github.com/cityhunteur/weather-service/internal/ratelimit"
+)
+
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func TestLimiter_Middleware(t *testing.T) {
+	t.Parallel()
+	store := ratelimit.NewMemoryStore(0)
+	defer store.Close()
+	limiter := ratelimit.NewLimiter(store, ratelimit.Limits{
+		Consumer:  ratelimit.Per(1, time.Hour, 3),
+		Anonymous: ratelimit.Per(1, time.Hour, 1),
+	})
+	keys, err := auth.NewAPIKeys([]*auth.APIKey{
+		{Name: "mobile-app", SHA256: auth.HashAPIKey("mobile-secret"), Routes: []string{"*"}, Enabled: true},
+		{Name: "dashboard", SHA256: auth.HashAPIKey("dashboard-secret"), Routes: []string{"*"}, Enabled: true},
+	})
+	require.NoError(t, err)
+
+	logger := zaptest.NewLogger(t).Sugar()
+	router := gin.New()
+	require.NoError(t, router.SetTrustedProxies(nil))
+	router.Use(auth.AuthenticateAPIKey(keys, logger), limiter.Middleware(logger))
+	router.GET("/v1/weather", func(c *gin.Context) { c.Status(http.StatusOK) })
+	get := func(apiKey, ip string) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/v1/weather", nil)
+		req.RemoteAddr = ip + ":1234"
+		if apiKey != "" {
+			req.Header.Set(auth.APIKeyHeader, apiKey)
+		}
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// consumers are limited by key, whatever their IP
+	for i, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		resp := get("mobile-secret", ip)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "3", resp.Header().Get(ratelimit.LimitHeader))
+		assert.Equal(t, []string{"2", "1", "0"}[i], resp.Header().Get(ratelimit.RemainingHeader))
+		assert.Equal(t, []string{"3600", "7200", "10800"}[i], resp.Header().Get(ratelimit.ResetHeader))
+	}
+	resp := get("mobile-secret", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "3600", resp.Header().Get("Retry-After"))
+	assert.Equal(t, "0", resp.Header().Get(ratelimit.RemainingHeader))
+	assert.Equal(t, http.StatusOK, get("dashboard-secret", "10.0.0.1").Code)
+
+	// unauthenticated clients are limited by IP
+	assert.Equal(t, http.StatusOK, get("", "10.0.0.1").Code)
+	resp = get("", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "1", resp.Header().Get(ratelimit.LimitHeader))
+	assert.Equal(t, http.StatusOK, get("", "10.0.0.2").Code)
+
+	// the X-Forwarded-For header of clients which are not trusted proxies is
+	// ignored
+	resp = httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/v1/weather", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "192.0.2.1")
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+
+	// limits are applied to the existing buckets once changed
+	limiter.SetLimits(ratelimit.Limits{
+		Consumer:  ratelimit.Per(1, time.Millisecond, 5),
+		Anonymous: ratelimit.Per(1, time.Hour, 1),
+	})
+	time.Sleep(10 * time.Millisecond)
+	resp = get("mobile-secret", "10.0.0.1")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "5", resp.Header().Get(ratelimit.LimitHeader))
+}
+
+func TestLimiter_Middleware_Methods(t *testing.T) {
+	t.Parallel()
+	store := ratelimit.NewMemoryStore(0)
+	defer store.Close()
+	limiter := ratelimit.NewLimiter(store, ratelimit.Limits{
+		Consumer:  ratelimit.Per(1, time.Hour, 1),
+		Anonymous: ratelimit.Per(1, time.Hour, 1),
+	})
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		id := &auth.Identity{Name: "client-42", Method: c.GetHeader("X-Method")}
+		c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), id))
+	}, limiter.Middleware(zaptest.NewLogger(t).Sugar()))
+	router.GET("/v1/weather", func(c *gin.Context) { c.Status(http.StatusOK) })
+	get := func(method string) int {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/v1/weather", nil)
+		req.Header.Set("X-Method", method)
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	// consumers of the same name authenticated otherwise have their own bucket
+	assert.Equal(t, http.StatusOK, get(auth.MethodAPIKey))
+	assert.Equal(t, http.StatusOK, get(auth.MethodJWT))
+	assert.Equal(t, http.StatusTooManyRequests, get(auth.MethodAPIKey))
+	assert.Equal(t, http.StatusTooManyRequests, get(auth.MethodJWT))
+}
+
+func TestLimiter_Middleware_InvalidCredentials(t *testing.T) {
+	t.Parallel()
+	store := ratelimit.NewMemoryStore(0)
+	defer store.Close()
+	limiter := ratelimit.NewLimiter(store, ratelimit.Limits{
+		Consumer:  ratelimit.Per(1, time.Hour, 3),
+		Anonymous: ratelimit.Per(1, time.Hour, 1),
+	})
+	keys, err := auth.NewAPIKeys(nil)
+	require.NoError(t, err)
+
+	logger := zaptest.NewLogger(t).Sugar()
+	router := gin.New()
+	router.Use(auth.AuthenticateAPIKey(keys, logger), limiter.Middleware(logger), auth.Required())
+	router.GET("/v1/weather", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// guessing API keys is limited by client IP
+	for _, want := range []int{http.StatusUnauthorized, http.StatusTooManyRequests} {
+		resp := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/v1/weather", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set(auth.APIKeyHeader, "guess")
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, want, resp.Code)
+		assert.Equal(t, "1", resp.Header().Get(ratelimit.LimitHeader))
+	}
+}
+
+func TestLimiter_Middleware_StoreError(t *testing.T) {
+	t.Parallel()
+	limiter := ratelimit.NewLimiter(failingStore{}, ratelimit.Limits{Anonymous: ratelimit.Per(1, time.Hour, 1)})
+
+	resp := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(resp)
+	router.GET("/v1/weather", limiter.Middleware(zaptest.NewLogger(t).Sugar()), func(c *gin.Context) { c.Status(http.StatusOK) })
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/v1/weather", nil)
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Empty(t, resp.Header().Get(ratelimit.LimitHeader))
+}
@@ -0,0 +1,82 @@
+// Package ratelimit limits the rate of requests of each client with token
+// buckets.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit is the token bucket of a client: the bucket holds up to Burst tokens,
+// refilled at Rate tokens per second, and each request takes a token.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Per returns the Limit of n requests per period, with the given burst.
+func Per(n int, period time.Duration, burst int) Limit {
+	return Limit{Rate: float64(n) / period.Seconds(), Burst: burst}
+}
+
+// Result is the state of a bucket after taking a token.
+type Result struct {
+	// Allowed reports whether a token was taken.
+	Allowed bool
+	// Remaining is the number of tokens left in the bucket.
+	Remaining int
+	// RetryAfter is the duration until a token is available, if none was.
+	RetryAfter time.Duration
+	// Reset is the duration until the bucket is full.
+	Reset time.Duration
+}
+
+// Store holds the buckets of the clients. Implementations must be safe for
+// concurrent use; a shared Store, e.g. backed by redis, limits clients across
+// the instances of the service.
+type Store interface {
+	// Take takes a token from the bucket of key, created full if missing.
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// bucket is the state of a token bucket.
+type bucket struct {
+	tokens float64
+	// updatedAt is the time tokens was last refilled.
+	updatedAt time.Time
+}
+
+// take refills b up to now and takes a token from it if any.
+func (b *bucket) take(now time.Time, limit Limit) Result {
+	burst := float64(limit.Burst)
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.updatedAt).Seconds()*limit.Rate)
+	b.updatedAt = now
+
+	res := Result{}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = refillDuration(1-b.tokens, limit.Rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = refillDuration(burst-b.tokens, limit.Rate)
+	return res
+}
+
+// full reports whether b is full at now, so that it can be forgotten.
+func (b *bucket) full(now time.Time, limit Limit) bool {
+	return b.tokens+now.Sub(b.updatedAt).Seconds()*limit.Rate >= float64(limit.Burst)
+}
+
+// refillDuration returns the duration to refill n tokens at rate.
+func refillDuration(n, rate float64) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	if rate <= 0 {
+		return math.MaxInt64
+	}
+	return time.Duration(n / rate * float64(time.Second))
+}
@@ -0,0 +1,21 @@
+package tlsconfig
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireClientCert returns a gin middleware rejecting requests whose client
+// did not present a certificate verified by the client CAs. The TLS config
+// created by New only verifies the certificates presented, so that routes
+// registered before this middleware, e.g. probes, are served to any client.
+func RequireClientCert() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Client certificate required."})
+			return
+		}
+		c.Next()
+	}
+}
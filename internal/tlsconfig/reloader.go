@@ -0,0 +1,103 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Reloader serves a certificate loaded from files, reloading it when the files
+// change, e.g. when they are renewed.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	logger   *zap.SugaredLogger
+
+	cert *tls.Certificate
+	// certModTime and keyModTime are the modification times of the files the
+	// certificate was loaded from.
+	certModTime time.Time
+	keyModTime  time.Time
+
+	mu sync.RWMutex
+}
+
+// NewReloader creates a new Reloader serving the certificate loaded from the
+// given files.
+func NewReloader(certFile, keyFile string, logger *zap.SugaredLogger) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   logger,
+	}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, for use as
+// tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Run checks the files every interval until ctx is done, reloading the
+// certificate when they changed. A certificate which fails to load is
+// logged, and the current certificate kept.
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				r.logger.Errorw("Failed to reload TLS certificate, keeping the current one", "error", err)
+			} else if reloaded {
+				r.logger.Infow("Reloaded TLS certificate", "cert", r.certFile)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// reload loads the certificate if its files changed since it was last loaded
+// and reports whether it did.
+func (r *Reloader) reload() (bool, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return false, fmt.Errorf("reading certificate file: %w", err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("reading key file: %w", err)
+	}
+
+	r.mu.RLock()
+	unchanged := certInfo.ModTime().Equal(r.certModTime) && keyInfo.ModTime().Equal(r.keyModTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("loading certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.certModTime = certInfo.ModTime()
+	r.keyModTime = keyInfo.ModTime()
+	return true, nil
+}
@@ -0,0 +1,62 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Config configures the TLS of a server, besides its certificate.
+type Config struct {
+	// MinVersion is the minimum TLS version accepted, either 1.2 or 1.3.
+	MinVersion string
+	// ClientCAFile is the path of the PEM encoded CAs verifying the
+	// certificates of clients. Certificates presented by clients are verified
+	// if set, and required by the routes using RequireClientCert.
+	ClientCAFile string
+}
+
+// versions are the TLS versions which can be set as minimum.
+var versions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ParseVersion returns the TLS version named v, e.g. 1.2.
+func ParseVersion(v string) (uint16, error) {
+	version, ok := versions[v]
+	if !ok {
+		return 0, fmt.Errorf("unsupported TLS version %q", v)
+	}
+	return version, nil
+}
+
+// New creates the TLS config of a server serving the certificate of r, over
+// HTTP/2 or HTTP/1.1.
+func New(cfg *Config, r *Reloader) (*tls.Config, error) {
+	minVersion, err := ParseVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: r.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+	if cfg.ClientCAFile != "" {
+		b, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.New("no certificate found in client CA file")
+		}
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsCfg, nil
+}
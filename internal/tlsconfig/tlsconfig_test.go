@@ -0,0 +1,213 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// testCert is a certificate and its key, in PEM and parsed forms.
+type testCert struct {
+	certPEM []byte
+	keyPEM  []byte
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+}
+
+// newTestCert creates a certificate for localhost signed by parent, or
+// self-signed if parent is nil.
+func newTestCert(t *testing.T, name string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	parentCert, parentKey := tmpl, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parentCert, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return &testCert{
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+		cert:    cert,
+		key:     key,
+	}
+}
+
+// write writes c to the given files, with the given modification time.
+func (c *testCert) write(t *testing.T, certFile, keyFile string, modTime time.Time) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(certFile, c.certPEM, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, c.keyPEM, 0o600))
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+}
+
+func TestReloader(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	modTime := time.Now().Add(-time.Minute)
+
+	first := newTestCert(t, "first", nil, false)
+	first.write(t, certFile, keyFile, modTime)
+	r, err := NewReloader(certFile, keyFile, zaptest.NewLogger(t).Sugar())
+	require.NoError(t, err)
+	got, _ := r.GetCertificate(nil)
+	assert.Equal(t, first.cert.Raw, got.Certificate[0])
+
+	// unchanged files are not reloaded
+	reloaded, err := r.reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+
+	// renewed files are
+	second := newTestCert(t, "second", nil, false)
+	second.write(t, certFile, keyFile, modTime.Add(time.Second))
+	reloaded, err = r.reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	got, _ = r.GetCertificate(nil)
+	assert.Equal(t, second.cert.Raw, got.Certificate[0])
+
+	// a key not matching the certificate keeps the current certificate
+	require.NoError(t, os.WriteFile(keyFile, first.keyPEM, 0o600))
+	require.NoError(t, os.Chtimes(keyFile, modTime.Add(2*time.Second), modTime.Add(2*time.Second)))
+	_, err = r.reload()
+	assert.Error(t, err)
+	got, _ = r.GetCertificate(nil)
+	assert.Equal(t, second.cert.Raw, got.Certificate[0])
+}
+
+func TestNewReloader_MissingFiles(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	_, err := NewReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), zaptest.NewLogger(t).Sugar())
+	assert.Error(t, err)
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	ca := newTestCert(t, "ca", nil, true)
+	server := newTestCert(t, "server", ca, false)
+	client := newTestCert(t, "client", ca, false)
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	server.write(t, certFile, keyFile, time.Now())
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, ca.certPEM, 0o600))
+
+	r, err := NewReloader(certFile, keyFile, zaptest.NewLogger(t).Sugar())
+	require.NoError(t, err)
+	tlsCfg, err := New(&Config{MinVersion: "1.3", ClientCAFile: caFile}, r)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/healthz", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.Use(RequireClientCert())
+	router.GET("/", func(c *gin.Context) { c.String(http.StatusOK, c.Request.Proto) })
+	srv := httptest.NewUnstartedServer(router)
+	srv.EnableHTTP2 = true
+	srv.TLS = tlsCfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(clientCfg *tls.Config, path string) (*http.Response, error) {
+		// httptest serves its own certificate to clients not sending a name
+		clientCfg.ServerName = "localhost"
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientCfg, ForceAttemptHTTP2: true}}
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL+path, nil)
+		require.NoError(t, err)
+		return client.Do(req)
+	}
+
+	// clients without a certificate are only served the routes not requiring
+	// one, e.g. probes
+	resp, err := get(&tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS13}, "/healthz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, err = get(&tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS13}, "/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// certificates must be signed by the client CA
+	other := newTestCert(t, "other", nil, false)
+	otherCert, err := tls.X509KeyPair(other.certPEM, other.keyPEM)
+	require.NoError(t, err)
+	_, err = get(&tls.Config{
+		RootCAs: roots,
+		// clients only send certificates of the requested CAs by default
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return &otherCert, nil },
+		MinVersion:           tls.VersionTLS13,
+	}, "/healthz")
+	assert.Error(t, err)
+
+	clientCert, err := tls.X509KeyPair(client.certPEM, client.keyPEM)
+	require.NoError(t, err)
+	resp, err = get(&tls.Config{RootCAs: roots, Certificates: []tls.Certificate{clientCert}, MinVersion: tls.VersionTLS13}, "/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "HTTP/2.0", resp.Proto)
+
+	// older versions are rejected
+	_, err = get(&tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{clientCert},
+		MinVersion:   tls.VersionTLS12,
+		MaxVersion:   tls.VersionTLS12,
+	}, "/")
+	assert.Error(t, err)
+}
+
+func TestNew_Errors(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0o600))
+
+	_, err := New(&Config{MinVersion: "1.1"}, nil)
+	assert.ErrorContains(t, err, "unsupported TLS version")
+	_, err = New(&Config{MinVersion: "1.2", ClientCAFile: caFile}, nil)
+	assert.ErrorContains(t, err, "no certificate found")
+}
@@ -0,0 +1,76 @@
+package usage
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/cityhunteur/weather-service/internal/auth"
+	"github.com/cityhunteur/weather-service/internal/logging"
+)
+
+// Headers of the monthly quota of a consumer.
+const (
+	QuotaLimitHeader     = "X-Quota-Limit"
+	QuotaRemainingHeader = "X-Quota-Remaining"
+)
+
+// Middleware returns a gin middleware accounting the usage of the requests of
+// authenticated consumers, so it must come after the authentication
+// middlewares. Consumers over their monthly quota are rejected with a 429 if
+// the quota blocks, and carry the X-Quota-* headers.
+func (t *Tracker) Middleware(logger *zap.SugaredLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := auth.FromContext(c.Request.Context())
+		if !ok {
+			c.Next()
+			return
+		}
+
+		quota := t.quota.Load()
+		used, admitted := t.admit(id.Name, quota)
+		if quota.Requests > 0 {
+			c.Header(QuotaLimitHeader, strconv.FormatInt(quota.Requests, 10))
+			c.Header(QuotaRemainingHeader, strconv.FormatInt(maxInt64(quota.Requests-used-1, 0), 10))
+			if used >= quota.Requests {
+				if !admitted {
+					c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"message": "Monthly quota exceeded."})
+					return
+				}
+				if t.warn(id.Name) {
+					logging.FromContext(c.Request.Context(), logger).Warnw("Consumer exceeded its monthly quota",
+						"quota", quota.Requests, "requests", used)
+				}
+			}
+		}
+
+		record := &Record{tracker: t, consumer: id.Name}
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), record))
+		c.Next()
+		t.Add(id.Name, record.finish())
+	}
+}
+
+// warn reports whether consumer is to be warned to be over quota, once a
+// month.
+func (t *Tracker) warn(consumer string) bool {
+	month := t.now().UTC().Format(monthLayout)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.warned[consumer] == month {
+		return false
+	}
+	t.warned[consumer] = month
+	return true
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
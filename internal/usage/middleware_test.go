@@ -0,0 +1,185 @@
+package usage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/cityhunteur/weather-service/internal/auth"
+)
+
+func TestTracker_Middleware(t *testing.T) {
+	t.Parallel()
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(upstream.Close)
+	client := &http.Client{Transport: Transport(nil)}
+
+	tests := []struct {
+		name           string
+		consumer       string
+		quota          Quota
+		wantStatusCode int
+		wantRemaining  string
+		wantCounters   Counters
+		wantWarning    bool
+	}{
+		{
+			name:           "anonymous",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "no quota",
+			consumer:       "mobile-app",
+			wantStatusCode: http.StatusOK,
+			wantCounters:   Counters{Requests: 3, Cities: 4, CacheHits: 1, UpstreamCalls: 3},
+		},
+		{
+			name:           "within quota",
+			consumer:       "mobile-app",
+			quota:          Quota{Requests: 5, Block: true},
+			wantStatusCode: http.StatusOK,
+			wantRemaining:  "2",
+			wantCounters:   Counters{Requests: 3, Cities: 4, CacheHits: 1, UpstreamCalls: 3},
+		},
+		{
+			name:           "over blocking quota",
+			consumer:       "mobile-app",
+			quota:          Quota{Requests: 2, Block: true},
+			wantStatusCode: http.StatusTooManyRequests,
+			wantRemaining:  "0",
+			wantCounters:   Counters{Requests: 2, Cities: 1, UpstreamCalls: 2},
+		},
+		{
+			name:           "over warning quota",
+			consumer:       "mobile-app",
+			quota:          Quota{Requests: 2},
+			wantStatusCode: http.StatusOK,
+			wantRemaining:  "0",
+			wantCounters:   Counters{Requests: 3, Cities: 4, CacheHits: 1, UpstreamCalls: 3},
+			wantWarning:    true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			core, logs := observer.New(zapcore.InfoLevel)
+			tracker, _ := newTestTracker(tt.quota)
+			if tt.consumer != "" {
+				tracker.Add(tt.consumer, Counters{Requests: 2, Cities: 1, UpstreamCalls: 2})
+			}
+
+			resp := httptest.NewRecorder()
+			_, router := gin.CreateTestContext(resp)
+			router.GET("/v1/weather",
+				func(c *gin.Context) {
+					if tt.consumer != "" {
+						id := &auth.Identity{Name: tt.consumer, Method: auth.MethodAPIKey}
+						c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), id))
+					}
+				},
+				tracker.Middleware(zap.New(core).Sugar()),
+				func(c *gin.Context) {
+					record := FromContext(c.Request.Context())
+					record.AddCities(3)
+					record.CacheHit()
+					req, _ := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, upstream.URL, nil)
+					resp, err := client.Do(req)
+					require.NoError(t, err)
+					resp.Body.Close()
+					c.Status(http.StatusOK)
+				})
+			req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/v1/weather", nil)
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.wantStatusCode, resp.Code)
+			assert.Equal(t, tt.wantRemaining, resp.Header().Get(QuotaRemainingHeader))
+			assert.Equal(t, tt.wantCounters, tracker.Month(tt.consumer))
+			assert.Equal(t, tt.wantWarning, logs.FilterMessage("Consumer exceeded its monthly quota").Len() == 1)
+		})
+	}
+}
+
+func TestTracker_Middleware_CallsAfterRequest(t *testing.T) {
+	t.Parallel()
+	tracker, _ := newTestTracker(Quota{})
+
+	var record *Record
+	_, router := gin.CreateTestContext(httptest.NewRecorder())
+	router.GET("/v1/weather",
+		func(c *gin.Context) {
+			id := &auth.Identity{Name: "mobile-app", Method: auth.MethodAPIKey}
+			c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), id))
+		},
+		tracker.Middleware(zap.NewNop().Sugar()),
+		func(c *gin.Context) {
+			record = FromContext(c.Request.Context())
+			record.UpstreamCall()
+			c.Status(http.StatusOK)
+		})
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/v1/weather", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, Counters{Requests: 1, UpstreamCalls: 1}, tracker.Month("mobile-app"))
+
+	// e.g. a background refresh started by the request
+	record.UpstreamCall()
+	assert.Equal(t, Counters{Requests: 1, UpstreamCalls: 2}, tracker.Month("mobile-app"))
+}
+
+func TestTracker_Middleware_Concurrent(t *testing.T) {
+	t.Parallel()
+	tracker, _ := newTestTracker(Quota{Requests: 5, Block: true})
+
+	// requests in flight count against the quota of the ones arriving
+	arrived := make(chan struct{}, 10)
+	release := make(chan struct{})
+	_, router := gin.CreateTestContext(httptest.NewRecorder())
+	router.GET("/v1/weather",
+		func(c *gin.Context) {
+			id := &auth.Identity{Name: "mobile-app", Method: auth.MethodAPIKey}
+			c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), id))
+		},
+		tracker.Middleware(zap.NewNop().Sugar()),
+		func(c *gin.Context) {
+			arrived <- struct{}{}
+			<-release
+			c.Status(http.StatusOK)
+		})
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := httptest.NewRecorder()
+			req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, "/v1/weather", nil)
+			router.ServeHTTP(resp, req)
+			codes <- resp.Code
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		<-arrived
+	}
+	assert.Eventually(t, func() bool { return len(codes) == 5 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(codes)
+
+	counts := make(map[int]int)
+	for code := range codes {
+		counts[code]++
+	}
+	assert.Equal(t, map[int]int{http.StatusOK: 5, http.StatusTooManyRequests: 5}, counts)
+	assert.Equal(t, int64(5), tracker.Month("mobile-app").Requests)
+}
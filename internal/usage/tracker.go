@@ -0,0 +1,255 @@
+package usage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// dayLayout formats the UTC days usage is aggregated by.
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+)
+
+// Quota is the monthly quota of requests of each consumer.
+type Quota struct {
+	// Requests is the number of requests allowed per calendar month, or 0
+	// for no quota.
+	Requests int64
+	// Block rejects the requests of consumers over their quota; otherwise a
+	// warning is logged.
+	Block bool
+}
+
+// DailyUsage is the usage of a consumer on a UTC day.
+type DailyUsage struct {
+	Consumer string
+	Day      time.Time
+	Counters
+}
+
+// Tracker aggregates the usage of consumers per UTC day. It is safe for
+// concurrent use.
+type Tracker struct {
+	// days holds the counters by consumer and day.
+	days  map[string]map[string]*Counters
+	quota atomic.Pointer[Quota]
+	// warned holds the month a consumer was last warned to be over quota.
+	warned map[string]string
+	now    func() time.Time
+
+	mu sync.Mutex
+}
+
+// NewTracker creates a new Tracker enforcing quota.
+func NewTracker(quota Quota) *Tracker {
+	t := &Tracker{
+		days:   make(map[string]map[string]*Counters),
+		warned: make(map[string]string),
+		now:    time.Now,
+	}
+	t.SetQuota(quota)
+	return t
+}
+
+// SetQuota changes the monthly quota of the consumers.
+func (t *Tracker) SetQuota(quota Quota) {
+	t.quota.Store(&quota)
+}
+
+// Add adds c to the usage of consumer today.
+func (t *Tracker) Add(consumer string, c Counters) {
+	day := t.now().UTC().Format(dayLayout)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.add(consumer, day, c)
+}
+
+// admit counts a request of consumer today, unless quota blocks and the
+// consumer is over it, and returns the requests of consumer in the current
+// month before it. The usage is checked and counted at once, so that
+// concurrent requests cannot exceed a blocking quota.
+func (t *Tracker) admit(consumer string, quota *Quota) (int64, bool) {
+	now := t.now().UTC()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	used := t.month(consumer, now.Format(monthLayout)).Requests
+	if quota.Block && quota.Requests > 0 && used >= quota.Requests {
+		return used, false
+	}
+	t.add(consumer, now.Format(dayLayout), Counters{Requests: 1})
+	return used, true
+}
+
+// add adds c to the usage of consumer on day. t.mu must be held.
+func (t *Tracker) add(consumer, day string, c Counters) {
+	days, found := t.days[consumer]
+	if !found {
+		days = make(map[string]*Counters)
+		t.days[consumer] = days
+	}
+	counters, found := days[day]
+	if !found {
+		counters = &Counters{}
+		days[day] = counters
+	}
+	counters.Add(c)
+}
+
+// Month returns the usage of consumer in the current calendar month.
+func (t *Tracker) Month(consumer string) Counters {
+	month := t.now().UTC().Format(monthLayout)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.month(consumer, month)
+}
+
+// month returns the usage of consumer in month. t.mu must be held.
+func (t *Tracker) month(consumer, month string) Counters {
+	var total Counters
+	for day, c := range t.days[consumer] {
+		if day[:len(monthLayout)] == month {
+			total.Add(*c)
+		}
+	}
+	return total
+}
+
+// Usage returns the usage of every consumer on the UTC days from from to to
+// inclusive, ordered by consumer and day.
+func (t *Tracker) Usage(from, to time.Time) []DailyUsage {
+	first, last := from.UTC().Format(dayLayout), to.UTC().Format(dayLayout)
+
+	t.mu.Lock()
+	var usage []DailyUsage
+	for consumer, days := range t.days {
+		for day, c := range days {
+			if day < first || day > last {
+				continue
+			}
+			// days are valid once stored
+			d, _ := time.Parse(dayLayout, day)
+			usage = append(usage, DailyUsage{Consumer: consumer, Day: d, Counters: *c})
+		}
+	}
+	t.mu.Unlock()
+
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Consumer != usage[j].Consumer {
+			return usage[i].Consumer < usage[j].Consumer
+		}
+		return usage[i].Day.Before(usage[j].Day)
+	})
+	return usage
+}
+
+// Prune removes the usage of the days before the UTC day of before, and
+// returns how many days of usage were removed.
+func (t *Tracker) Prune(before time.Time) int {
+	first := before.UTC().Format(dayLayout)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pruned := 0
+	for consumer, days := range t.days {
+		for day := range days {
+			if day < first {
+				delete(days, day)
+				pruned++
+			}
+		}
+		if len(days) == 0 {
+			delete(t.days, consumer)
+		}
+	}
+	return pruned
+}
+
+// Save writes the usage to the file at path as JSON. The file is replaced
+// atomically so that a crash while saving never leaves a partial file behind.
+func (t *Tracker) Save(path string) error {
+	t.mu.Lock()
+	b, err := json.Marshal(t.days)
+	t.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("encoding usage: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("creating usage file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing usage file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing usage file: %w", err)
+	}
+	return nil
+}
+
+// Load adds the usage saved to the file at path. A missing file is not an
+// error. Nothing is added if the file is invalid.
+func (t *Tracker) Load(path string) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading usage file: %w", err)
+	}
+
+	var saved map[string]map[string]*Counters
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return fmt.Errorf("parsing usage file %s: %w", path, err)
+	}
+	for _, days := range saved {
+		for day, c := range days {
+			if _, err := time.Parse(dayLayout, day); err != nil || c == nil {
+				return fmt.Errorf("parsing usage file %s: invalid usage of day %q", path, day)
+			}
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for consumer, days := range saved {
+		if t.days[consumer] == nil {
+			t.days[consumer] = make(map[string]*Counters)
+		}
+		for day, c := range days {
+			if counters, found := t.days[consumer][day]; found {
+				counters.Add(*c)
+			} else {
+				t.days[consumer][day] = c
+			}
+		}
+	}
+	return nil
+}
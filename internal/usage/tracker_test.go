@@ -0,0 +1,75 @@
+package usage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTracker(quota Quota) (*Tracker, *time.Time) {
+	now := time.Date(2023, 7, 31, 23, 0, 0, 0, time.UTC)
+	t := NewTracker(quota)
+	t.now = func() time.Time { return now }
+	return t, &now
+}
+
+func TestTracker(t *testing.T) {
+	t.Parallel()
+	tracker, now := newTestTracker(Quota{})
+
+	tracker.Add("mobile-app", Counters{Requests: 1, Cities: 3, CacheHits: 2, UpstreamCalls: 2})
+	tracker.Add("mobile-app", Counters{Requests: 1, Cities: 1, UpstreamCalls: 3})
+	tracker.Add("dashboard", Counters{Requests: 1, Cities: 1, CacheHits: 1})
+	*now = now.Add(2 * time.Hour)
+	tracker.Add("mobile-app", Counters{Requests: 1, Cities: 1, CacheHits: 1})
+
+	// the month restarts on the first UTC day
+	assert.Equal(t, Counters{Requests: 1, Cities: 1, CacheHits: 1}, tracker.Month("mobile-app"))
+	assert.Equal(t, Counters{}, tracker.Month("dashboard"))
+
+	july31 := time.Date(2023, 7, 31, 0, 0, 0, 0, time.UTC)
+	aug1 := time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, []DailyUsage{
+		{Consumer: "dashboard", Day: july31, Counters: Counters{Requests: 1, Cities: 1, CacheHits: 1}},
+		{Consumer: "mobile-app", Day: july31, Counters: Counters{Requests: 2, Cities: 4, CacheHits: 2, UpstreamCalls: 5}},
+		{Consumer: "mobile-app", Day: aug1, Counters: Counters{Requests: 1, Cities: 1, CacheHits: 1}},
+	}, tracker.Usage(july31, aug1.Add(time.Hour)))
+	assert.Len(t, tracker.Usage(aug1, aug1), 1)
+
+	assert.Equal(t, 2, tracker.Prune(aug1))
+	assert.Equal(t, []DailyUsage{
+		{Consumer: "mobile-app", Day: aug1, Counters: Counters{Requests: 1, Cities: 1, CacheHits: 1}},
+	}, tracker.Usage(july31, aug1))
+}
+
+func TestTracker_SaveLoad(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "usage.json")
+	tracker, _ := newTestTracker(Quota{})
+	tracker.Add("mobile-app", Counters{Requests: 1, Cities: 2, UpstreamCalls: 4})
+	require.NoError(t, tracker.Save(path))
+
+	// the saved usage is added to the usage since the start
+	restored, _ := newTestTracker(Quota{})
+	restored.Add("mobile-app", Counters{Requests: 1, Cities: 1, CacheHits: 1})
+	require.NoError(t, restored.Load(path))
+	assert.Equal(t, Counters{Requests: 2, Cities: 3, CacheHits: 1, UpstreamCalls: 4}, restored.Month("mobile-app"))
+
+	// a missing file is not an error
+	require.NoError(t, restored.Load(filepath.Join(t.TempDir(), "missing.json")))
+
+	// invalid files are rejected as a whole
+	for _, content := range []string{
+		`{"mobile-app": {"2023-07-31": {"requests": 1}, "yesterday": {"requests": 1}}}`,
+		`{"mobile-app": {"2023-07-31": null}}`,
+		`[`,
+	} {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		assert.Error(t, restored.Load(path), content)
+	}
+	assert.Equal(t, Counters{Requests: 2, Cities: 3, CacheHits: 1, UpstreamCalls: 4}, restored.Month("mobile-app"))
+}
@@ -0,0 +1,125 @@
+// Package usage accounts the usage of the service by API consumer, per day,
+// and enforces their monthly quotas.
+package usage
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Counters count the usage of a consumer.
+type Counters struct {
+	Requests int64 `json:"requests"`
+	// Cities is the number of cities requested.
+	Cities int64 `json:"cities"`
+	// CacheHits is the number of forecasts served from the cache.
+	CacheHits int64 `json:"cacheHits"`
+	// UpstreamCalls is the number of calls made to the upstream APIs.
+	UpstreamCalls int64 `json:"upstreamCalls"`
+}
+
+// Add adds o to c.
+func (c *Counters) Add(o Counters) {
+	c.Requests += o.Requests
+	c.Cities += o.Cities
+	c.CacheHits += o.CacheHits
+	c.UpstreamCalls += o.UpstreamCalls
+}
+
+// Record accumulates the usage of a request. Its methods are safe for
+// concurrent use, and do nothing on a nil Record so that requests which are
+// not accounted need no special handling. Upstream calls counted once the
+// request has completed, e.g. by a refresh it started in the background or a
+// load it shares with other requests, are added to the usage of its consumer
+// directly.
+type Record struct {
+	cities    atomic.Int64
+	cacheHits atomic.Int64
+
+	// tracker tracks the usage of consumer, if the record is accounted by a
+	// Tracker.
+	tracker  *Tracker
+	consumer string
+
+	// mu guards the upstream calls counted until the record is done.
+	mu            sync.Mutex
+	upstreamCalls int64
+	done          bool
+}
+
+// AddCities counts n requested cities.
+func (r *Record) AddCities(n int) {
+	if r != nil {
+		r.cities.Add(int64(n))
+	}
+}
+
+// CacheHit counts a forecast served from the cache.
+func (r *Record) CacheHit() {
+	if r != nil {
+		r.cacheHits.Add(1)
+	}
+}
+
+// UpstreamCall counts a call to an upstream API.
+func (r *Record) UpstreamCall() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	if !r.done {
+		r.upstreamCalls++
+		r.mu.Unlock()
+		return
+	}
+	r.mu.Unlock()
+	r.tracker.Add(r.consumer, Counters{UpstreamCalls: 1})
+}
+
+// finish returns the counters of the request of r, besides the request itself
+// which is counted when admitted. Upstream calls counted from then on are
+// added to the usage of the consumer by its tracker.
+func (r *Record) finish() Counters {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done = true
+	return Counters{
+		Cities:        r.cities.Load(),
+		CacheHits:     r.cacheHits.Load(),
+		UpstreamCalls: r.upstreamCalls,
+	}
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying r.
+func NewContext(ctx context.Context, r *Record) context.Context {
+	return context.WithValue(ctx, contextKey{}, r)
+}
+
+// FromContext returns the record carried by ctx, or nil.
+func FromContext(ctx context.Context) *Record {
+	r, _ := ctx.Value(contextKey{}).(*Record)
+	return r
+}
+
+// Transport returns an http.RoundTripper counting the calls made through base
+// in the record of their request context, if any. A nil base means
+// http.DefaultTransport.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		FromContext(req.Context()).UpstreamCall()
+		return base.RoundTrip(req)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}